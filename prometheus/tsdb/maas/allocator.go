@@ -9,10 +9,23 @@ import (
 
 // ChunkAllocator manages chunk allocation using MaaS backend with intelligent pooling
 type ChunkAllocator struct {
-	poolManager  *MemoryPoolManager
-	logger       *slog.Logger
-	mu           sync.RWMutex
-	chunkToAlloc map[uintptr]string // Maps chunk memory address to MaaS allocation ID
+	poolManager *MemoryPoolManager
+	logger      *slog.Logger
+	mu          sync.RWMutex
+	chunks      map[uintptr]trackedChunk // Maps chunk memory address to its MaaS backend, allocation ID and bytes
+
+	drainMu sync.Mutex
+	drains  map[int]*decommissionState
+
+	batchCh chan allocRequest
+}
+
+// trackedChunk is what ChunkAllocator remembers about a chunk it handed
+// out from a MaaS backend, so it can both release it and, during a
+// Decommission, migrate it to another backend.
+type trackedChunk struct {
+	Ref  allocRef
+	Data []byte
 }
 
 const (
@@ -22,13 +35,30 @@ const (
 	DefaultLocalThresholdMB = 512
 )
 
-// NewChunkAllocator creates a new MaaS-backed chunk allocator
+// NewChunkAllocator creates a new MaaS-backed chunk allocator talking to a
+// single backend.
 func NewChunkAllocator(maasURL string, logger *slog.Logger, fallback bool) *ChunkAllocator {
-	return &ChunkAllocator{
-		poolManager:  NewMemoryPoolManager(maasURL, DefaultLocalThresholdMB, fallback, logger),
-		logger:       logger,
-		chunkToAlloc: make(map[uintptr]string),
+	ca := &ChunkAllocator{
+		poolManager: NewMemoryPoolManager(maasURL, DefaultLocalThresholdMB, fallback, logger),
+		logger:      logger,
+		chunks:      make(map[uintptr]trackedChunk),
+		batchCh:     make(chan allocRequest, batchQueueSize),
+	}
+	go ca.batcher()
+	return ca
+}
+
+// NewShardedChunkAllocator creates a MaaS-backed chunk allocator that
+// shards allocations across multiple backends via router.
+func NewShardedChunkAllocator(backends []BackendConfig, router Router, logger *slog.Logger, fallback bool) *ChunkAllocator {
+	ca := &ChunkAllocator{
+		poolManager: NewShardedMemoryPoolManager(backends, router, DefaultLocalThresholdMB, fallback, logger),
+		logger:      logger,
+		chunks:      make(map[uintptr]trackedChunk),
+		batchCh:     make(chan allocRequest, batchQueueSize),
 	}
+	go ca.batcher()
+	return ca
 }
 
 // Initialize connects to MaaS backend
@@ -38,24 +68,19 @@ func (ca *ChunkAllocator) Initialize() error {
 
 // AllocateChunk allocates memory for a chunk, intelligently choosing local vs MaaS
 func (ca *ChunkAllocator) AllocateChunk(size int) ([]byte, error) {
-	// Use pool manager to decide allocation strategy
-	data, allocID, err := ca.poolManager.AllocateBytes(size)
+	return ca.AllocateChunkWithKey(size, "")
+}
+
+// AllocateChunkWithKey is AllocateChunk with a caller-supplied affinity key,
+// used by routers (such as consistent hashing) that keep related chunks on
+// the same backend. The call makes no round trip of its own: it enqueues
+// onto the batcher, which amortizes many chunk allocations into one round
+// trip per backend, and blocks until that batch's reply arrives.
+func (ca *ChunkAllocator) AllocateChunkWithKey(size int, key string) ([]byte, error) {
+	data, err := ca.enqueueAllocation(size, key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to allocate chunk: %w", err)
 	}
-	
-	// Track MaaS allocations
-	if allocID != "" {
-		chunkPtr := uintptr(0)
-		if len(data) > 0 {
-			chunkPtr = uintptr(unsafe.Pointer(&data[0]))
-		}
-		
-		ca.mu.Lock()
-		ca.chunkToAlloc[chunkPtr] = allocID
-		ca.mu.Unlock()
-	}
-	
 	return data, nil
 }
 
@@ -66,11 +91,11 @@ func (ca *ChunkAllocator) DeallocateChunk(chunk []byte) error {
 	}
 
 	chunkPtr := uintptr(unsafe.Pointer(&chunk[0]))
-	
+
 	ca.mu.Lock()
-	allocID, exists := ca.chunkToAlloc[chunkPtr]
+	tc, exists := ca.chunks[chunkPtr]
 	if exists {
-		delete(ca.chunkToAlloc, chunkPtr)
+		delete(ca.chunks, chunkPtr)
 	}
 	ca.mu.Unlock()
 
@@ -79,8 +104,9 @@ func (ca *ChunkAllocator) DeallocateChunk(chunk []byte) error {
 		return nil
 	}
 
-	// Deallocate from MaaS
-	return ca.poolManager.DeallocateBytes(chunk, allocID)
+	// Deallocate from the backend it currently belongs to (which may
+	// differ from where it started if it was migrated by Decommission).
+	return ca.poolManager.DeallocateBytes(chunk, tc.Ref)
 }
 
 // GetStats returns allocation statistics
@@ -103,4 +129,4 @@ func (ca *ChunkAllocator) Cleanup() error {
 // SetThreshold updates when to use MaaS (in MB)
 func (ca *ChunkAllocator) SetThreshold(thresholdMB uint64) {
 	ca.poolManager.SetThreshold(thresholdMB)
-}
\ No newline at end of file
+}
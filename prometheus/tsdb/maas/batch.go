@@ -0,0 +1,149 @@
+package maas
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// batchRPCTimeout bounds a single batched Allocate/Deallocate round trip.
+// Without it, a connected-but-silent backend would stall the batcher
+// goroutine (and every allocation queued behind it) indefinitely, since
+// AllocateChunk otherwise waits on context.Background().
+const batchRPCTimeout = 5 * time.Second
+
+// BatchRequest is the wire payload for a coalesced Allocate call.
+type BatchRequest struct {
+	Requests []AllocateRequest `json:"requests"`
+}
+
+// BatchResponseItem is either a populated AllocateResponse or an Error,
+// one per request, in the same order as BatchRequest.Requests.
+type BatchResponseItem struct {
+	AllocateResponse
+	Error string `json:"error,omitempty"`
+}
+
+// BatchResponse is the wire payload returned for a coalesced Allocate call.
+type BatchResponse struct {
+	Responses []BatchResponseItem `json:"responses"`
+}
+
+// batchDeallocateRequest is the wire payload for a coalesced Deallocate call.
+type batchDeallocateRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type batchDeallocateResponseItem struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+type batchDeallocateResponse struct {
+	Responses []batchDeallocateResponseItem `json:"responses"`
+}
+
+// AllocateBatch requests memory for every size in one round trip. The
+// returned slice has the same length and order as sizes; an entry is nil
+// if that particular request failed, with the first such failure also
+// returned as err.
+func (c *Client) AllocateBatch(sizes []int) ([]*Allocation, error) {
+	reqs := make([]AllocateRequest, len(sizes))
+	for i, size := range sizes {
+		reqs[i] = AllocateRequest{SizeBytes: size}
+	}
+	payload, err := c.marshalPayload(BatchRequest{Requests: reqs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal batch request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), batchRPCTimeout)
+	defer cancel()
+
+	resp, err := c.conn.call(ctx, "allocate_batch", payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate batch from MaaS: %w", err)
+	}
+
+	var batchResp BatchResponse
+	if err := c.unmarshalPayload(resp.Payload, &batchResp); err != nil {
+		return nil, fmt.Errorf("failed to decode batch response: %w", err)
+	}
+
+	if len(batchResp.Responses) != len(sizes) {
+		return nil, fmt.Errorf("maas: batch response has %d items, want %d", len(batchResp.Responses), len(sizes))
+	}
+
+	now := time.Now()
+	allocs := make([]*Allocation, len(batchResp.Responses))
+	var firstErr error
+
+	for i, item := range batchResp.Responses {
+		if item.Error != "" {
+			if firstErr == nil {
+				firstErr = errors.New(item.Error)
+			}
+			continue
+		}
+
+		alloc := &Allocation{
+			ID:              item.ID,
+			SizeBytes:       item.SizeBytes,
+			ActualSizeBytes: item.ActualSizeBytes,
+			Data:            make([]byte, item.ActualSizeBytes),
+			AllocatedAt:     now,
+		}
+		if item.LeaseSeconds > 0 {
+			alloc.LeaseExpiresAt = now.Add(time.Duration(item.LeaseSeconds) * time.Second)
+			c.trackLease(alloc.ID, alloc.LeaseExpiresAt)
+		}
+
+		c.mu.Lock()
+		c.allocations[alloc.ID] = alloc
+		c.mu.Unlock()
+
+		allocs[i] = alloc
+	}
+
+	return allocs, firstErr
+}
+
+// DeallocateBatch releases every ID in one round trip, returning the first
+// per-ID failure encountered, if any.
+func (c *Client) DeallocateBatch(ids []string) error {
+	payload, err := c.marshalPayload(batchDeallocateRequest{IDs: ids})
+	if err != nil {
+		return fmt.Errorf("failed to marshal batch request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), batchRPCTimeout)
+	defer cancel()
+
+	resp, err := c.conn.call(ctx, "deallocate_batch", payload)
+	if err != nil {
+		return fmt.Errorf("failed to deallocate batch from MaaS: %w", err)
+	}
+
+	var batchResp batchDeallocateResponse
+	if err := c.unmarshalPayload(resp.Payload, &batchResp); err != nil {
+		return fmt.Errorf("failed to decode batch response: %w", err)
+	}
+
+	var firstErr error
+	for _, item := range batchResp.Responses {
+		if item.Error != "" {
+			if firstErr == nil {
+				firstErr = errors.New(item.Error)
+			}
+			continue
+		}
+
+		c.untrackLease(item.ID)
+		c.mu.Lock()
+		delete(c.allocations, item.ID)
+		c.mu.Unlock()
+	}
+
+	return firstErr
+}
@@ -0,0 +1,432 @@
+package maas
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// allocateResponsePool reuses *AllocateResponse structs on the hot
+// allocate path, whichever codec is active, avoiding one allocation per
+// response on top of the scratch buffer below.
+var allocateResponsePool = sync.Pool{
+	New: func() any { return new(AllocateResponse) },
+}
+
+// scratchBufferPool reuses byte slices for binary encoding/decoding so the
+// 1KB-chunk hot path doesn't grow a new buffer per call.
+var scratchBufferPool = sync.Pool{
+	New: func() any { b := make([]byte, 0, 64); return &b },
+}
+
+func getScratchBuffer() []byte {
+	buf := scratchBufferPool.Get().(*[]byte)
+	return (*buf)[:0]
+}
+
+func putScratchBuffer(buf []byte) {
+	scratchBufferPool.Put(&buf)
+}
+
+// appendID appends id to buf, using a fixed 16-byte encoding when id
+// parses as a UUID and a varint-length-prefixed string otherwise.
+func appendID(buf []byte, id string) []byte {
+	if u, ok := uuidToBytes(id); ok {
+		buf = append(buf, 1)
+		return append(buf, u[:]...)
+	}
+	buf = append(buf, 0)
+	buf = binary.AppendUvarint(buf, uint64(len(id)))
+	return append(buf, id...)
+}
+
+// readID reads an ID encoded by appendID, returning the remaining bytes.
+func readID(data []byte) (id string, rest []byte, err error) {
+	if len(data) < 1 {
+		return "", nil, fmt.Errorf("maas: truncated id")
+	}
+	flag := data[0]
+	data = data[1:]
+
+	if flag == 1 {
+		if len(data) < 16 {
+			return "", nil, fmt.Errorf("maas: truncated uuid")
+		}
+		var u [16]byte
+		copy(u[:], data[:16])
+		return uuidFromBytes(u), data[16:], nil
+	}
+
+	n, size := binary.Uvarint(data)
+	if size <= 0 {
+		return "", nil, fmt.Errorf("maas: invalid id length prefix")
+	}
+	data = data[size:]
+	if uint64(len(data)) < n {
+		return "", nil, fmt.Errorf("maas: truncated id string")
+	}
+	return string(data[:n]), data[n:], nil
+}
+
+func uuidToBytes(id string) ([16]byte, bool) {
+	var out [16]byte
+	clean := strings.ReplaceAll(id, "-", "")
+	if len(clean) != 32 {
+		return out, false
+	}
+	b, err := hex.DecodeString(clean)
+	if err != nil {
+		return out, false
+	}
+	copy(out[:], b)
+	return out, true
+}
+
+func uuidFromBytes(b [16]byte) string {
+	h := hex.EncodeToString(b[:])
+	return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32])
+}
+
+// readCount decodes a varint item count prefix, rejecting counts that
+// can't possibly fit in the remaining data (every batch item is at least
+// one byte on the wire), so a truncated or corrupt frame can't make us
+// allocate a slice sized from attacker-controlled garbage.
+func readCount(data []byte) (count uint64, rest []byte, err error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("maas: invalid batch count encoding")
+	}
+	rest = data[n:]
+	if count > uint64(len(rest)) {
+		return 0, nil, fmt.Errorf("maas: batch count %d exceeds remaining frame size", count)
+	}
+	return count, rest, nil
+}
+
+// MarshalBinary encodes an AllocateRequest as a single varint.
+func (r AllocateRequest) MarshalBinary() ([]byte, error) {
+	return binary.AppendUvarint(getScratchBuffer(), uint64(r.SizeBytes)), nil
+}
+
+// UnmarshalBinary decodes an AllocateRequest encoded by MarshalBinary.
+func (r *AllocateRequest) UnmarshalBinary(data []byte) error {
+	v, n := binary.Uvarint(data)
+	if n <= 0 {
+		return fmt.Errorf("maas: invalid AllocateRequest encoding")
+	}
+	r.SizeBytes = int(v)
+	return nil
+}
+
+// MarshalBinary encodes an IDRequest as a single appendID-encoded ID.
+func (r IDRequest) MarshalBinary() ([]byte, error) {
+	return appendID(getScratchBuffer(), r.ID), nil
+}
+
+// UnmarshalBinary decodes an IDRequest encoded by MarshalBinary.
+func (r *IDRequest) UnmarshalBinary(data []byte) error {
+	id, _, err := readID(data)
+	if err != nil {
+		return fmt.Errorf("maas: invalid IDRequest encoding: %w", err)
+	}
+	r.ID = id
+	return nil
+}
+
+// MarshalBinary encodes an AllocateResponse as: id, varints for
+// SizeBytes/ActualSizeBytes, the raw big-endian bits of SizeMB, then
+// varints for AgeSeconds/LeaseSeconds.
+func (r AllocateResponse) MarshalBinary() ([]byte, error) {
+	buf := appendID(getScratchBuffer(), r.ID)
+	buf = binary.AppendUvarint(buf, uint64(r.SizeBytes))
+	buf = binary.AppendUvarint(buf, uint64(r.ActualSizeBytes))
+	buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(r.SizeMB))
+	buf = binary.AppendVarint(buf, r.AgeSeconds)
+	buf = binary.AppendVarint(buf, r.LeaseSeconds)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes an AllocateResponse encoded by MarshalBinary.
+func (r *AllocateResponse) UnmarshalBinary(data []byte) error {
+	id, rest, err := readID(data)
+	if err != nil {
+		return err
+	}
+	r.ID = id
+
+	sizeBytes, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return fmt.Errorf("maas: invalid AllocateResponse encoding (size_bytes)")
+	}
+	rest = rest[n:]
+
+	actualSizeBytes, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return fmt.Errorf("maas: invalid AllocateResponse encoding (actual_size_bytes)")
+	}
+	rest = rest[n:]
+
+	if len(rest) < 8 {
+		return fmt.Errorf("maas: invalid AllocateResponse encoding (size_mb)")
+	}
+	sizeMB := math.Float64frombits(binary.BigEndian.Uint64(rest[:8]))
+	rest = rest[8:]
+
+	ageSeconds, n := binary.Varint(rest)
+	if n <= 0 {
+		return fmt.Errorf("maas: invalid AllocateResponse encoding (age_seconds)")
+	}
+	rest = rest[n:]
+
+	leaseSeconds, n := binary.Varint(rest)
+	if n <= 0 {
+		return fmt.Errorf("maas: invalid AllocateResponse encoding (lease_seconds)")
+	}
+
+	r.SizeBytes = int(sizeBytes)
+	r.ActualSizeBytes = int(actualSizeBytes)
+	r.SizeMB = sizeMB
+	r.AgeSeconds = ageSeconds
+	r.LeaseSeconds = leaseSeconds
+	return nil
+}
+
+// MarshalBinary encodes a BatchRequest as a count followed by each
+// request's own binary encoding (each is self-delimiting, being a single
+// varint).
+func (r BatchRequest) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendUvarint(getScratchBuffer(), uint64(len(r.Requests)))
+	for _, req := range r.Requests {
+		buf = binary.AppendUvarint(buf, uint64(req.SizeBytes))
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a BatchRequest encoded by MarshalBinary.
+func (r *BatchRequest) UnmarshalBinary(data []byte) error {
+	count, data, err := readCount(data)
+	if err != nil {
+		return err
+	}
+
+	reqs := make([]AllocateRequest, count)
+	for i := range reqs {
+		size, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("maas: truncated BatchRequest at item %d", i)
+		}
+		reqs[i] = AllocateRequest{SizeBytes: int(size)}
+		data = data[n:]
+	}
+	r.Requests = reqs
+	return nil
+}
+
+// MarshalBinary encodes a BatchResponse as a count followed by, for each
+// item, a one-byte ok/error flag and either the item's AllocateResponse
+// encoding or a varint-length-prefixed error string.
+func (r BatchResponse) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendUvarint(getScratchBuffer(), uint64(len(r.Responses)))
+	for _, item := range r.Responses {
+		if item.Error != "" {
+			buf = append(buf, 1)
+			buf = binary.AppendUvarint(buf, uint64(len(item.Error)))
+			buf = append(buf, item.Error...)
+			continue
+		}
+		buf = append(buf, 0)
+		itemBytes, err := item.AllocateResponse.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, itemBytes...)
+		putScratchBuffer(itemBytes)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a BatchResponse encoded by MarshalBinary. Because
+// AllocateResponse's binary encoding isn't self-length-prefixed, decoding
+// consumes directly from the shared cursor via unmarshalBinaryCursor.
+func (r *BatchResponse) UnmarshalBinary(data []byte) error {
+	count, data, err := readCount(data)
+	if err != nil {
+		return err
+	}
+
+	items := make([]BatchResponseItem, count)
+	for i := range items {
+		if len(data) < 1 {
+			return fmt.Errorf("maas: truncated BatchResponse at item %d", i)
+		}
+		isError := data[0]
+		data = data[1:]
+
+		if isError == 1 {
+			strLen, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("maas: truncated BatchResponse error at item %d", i)
+			}
+			data = data[n:]
+			if uint64(len(data)) < strLen {
+				return fmt.Errorf("maas: truncated BatchResponse error body at item %d", i)
+			}
+			items[i].Error = string(data[:strLen])
+			data = data[strLen:]
+			continue
+		}
+
+		var resp AllocateResponse
+		consumed, err := resp.unmarshalBinaryCursor(data)
+		if err != nil {
+			return fmt.Errorf("maas: item %d: %w", i, err)
+		}
+		items[i].AllocateResponse = resp
+		data = data[consumed:]
+	}
+	r.Responses = items
+	return nil
+}
+
+// unmarshalBinaryCursor is like UnmarshalBinary but also reports how many
+// bytes of data it consumed, so callers can decode a stream of
+// concatenated AllocateResponses (as BatchResponse does).
+func (r *AllocateResponse) unmarshalBinaryCursor(data []byte) (int, error) {
+	start := len(data)
+
+	id, rest, err := readID(data)
+	if err != nil {
+		return 0, err
+	}
+	r.ID = id
+
+	sizeBytes, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid size_bytes")
+	}
+	rest = rest[n:]
+
+	actualSizeBytes, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid actual_size_bytes")
+	}
+	rest = rest[n:]
+
+	if len(rest) < 8 {
+		return 0, fmt.Errorf("invalid size_mb")
+	}
+	sizeMB := math.Float64frombits(binary.BigEndian.Uint64(rest[:8]))
+	rest = rest[8:]
+
+	ageSeconds, n := binary.Varint(rest)
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid age_seconds")
+	}
+	rest = rest[n:]
+
+	leaseSeconds, n := binary.Varint(rest)
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid lease_seconds")
+	}
+	rest = rest[n:]
+
+	r.SizeBytes = int(sizeBytes)
+	r.ActualSizeBytes = int(actualSizeBytes)
+	r.SizeMB = sizeMB
+	r.AgeSeconds = ageSeconds
+	r.LeaseSeconds = leaseSeconds
+
+	return start - len(rest), nil
+}
+
+// MarshalBinary encodes a batchDeallocateRequest as a count followed by
+// each ID via appendID.
+func (r batchDeallocateRequest) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendUvarint(getScratchBuffer(), uint64(len(r.IDs)))
+	for _, id := range r.IDs {
+		buf = appendID(buf, id)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a batchDeallocateRequest encoded by MarshalBinary.
+func (r *batchDeallocateRequest) UnmarshalBinary(data []byte) error {
+	count, data, err := readCount(data)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, count)
+	for i := range ids {
+		id, rest, err := readID(data)
+		if err != nil {
+			return fmt.Errorf("maas: truncated batchDeallocateRequest at item %d: %w", i, err)
+		}
+		ids[i] = id
+		data = rest
+	}
+	r.IDs = ids
+	return nil
+}
+
+// MarshalBinary encodes a batchDeallocateResponse as a count followed by,
+// for each item, a one-byte ok/error flag and either the item's ID via
+// appendID or a varint-length-prefixed error string.
+func (r batchDeallocateResponse) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendUvarint(getScratchBuffer(), uint64(len(r.Responses)))
+	for _, item := range r.Responses {
+		if item.Error != "" {
+			buf = append(buf, 1)
+			buf = binary.AppendUvarint(buf, uint64(len(item.Error)))
+			buf = append(buf, item.Error...)
+			continue
+		}
+		buf = append(buf, 0)
+		buf = appendID(buf, item.ID)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a batchDeallocateResponse encoded by
+// MarshalBinary.
+func (r *batchDeallocateResponse) UnmarshalBinary(data []byte) error {
+	count, data, err := readCount(data)
+	if err != nil {
+		return err
+	}
+
+	items := make([]batchDeallocateResponseItem, count)
+	for i := range items {
+		if len(data) < 1 {
+			return fmt.Errorf("maas: truncated batchDeallocateResponse at item %d", i)
+		}
+		isError := data[0]
+		data = data[1:]
+
+		if isError == 1 {
+			strLen, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("maas: truncated batchDeallocateResponse error at item %d", i)
+			}
+			data = data[n:]
+			if uint64(len(data)) < strLen {
+				return fmt.Errorf("maas: truncated batchDeallocateResponse error body at item %d", i)
+			}
+			items[i].Error = string(data[:strLen])
+			data = data[strLen:]
+			continue
+		}
+
+		id, rest, err := readID(data)
+		if err != nil {
+			return fmt.Errorf("maas: item %d: %w", i, err)
+		}
+		items[i].ID = id
+		data = rest
+	}
+	r.Responses = items
+	return nil
+}
@@ -0,0 +1,152 @@
+package maas
+
+import "testing"
+
+func TestAllocateRequestBinaryRoundTrip(t *testing.T) {
+	cases := []AllocateRequest{
+		{SizeBytes: 0},
+		{SizeBytes: 1024},
+		{SizeBytes: 1 << 20},
+	}
+	for _, want := range cases {
+		data, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary(%+v): %v", want, err)
+		}
+		var got AllocateRequest
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+		}
+		if got != want {
+			t.Errorf("round trip mismatch: got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestAllocateResponseBinaryRoundTrip(t *testing.T) {
+	cases := []AllocateResponse{
+		{},
+		{ID: "abc123", SizeBytes: 1024, ActualSizeBytes: 1024, SizeMB: 0.0009765625, AgeSeconds: 42, LeaseSeconds: 30},
+		{ID: "550e8400-e29b-41d4-a716-446655440000", SizeBytes: 4096, ActualSizeBytes: 4096, SizeMB: 0.0, AgeSeconds: -1, LeaseSeconds: 0},
+	}
+	for _, want := range cases {
+		data, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary(%+v): %v", want, err)
+		}
+		var got AllocateResponse
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+		}
+		if got != want {
+			t.Errorf("round trip mismatch: got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestIDRequestBinaryRoundTrip(t *testing.T) {
+	cases := []IDRequest{
+		{ID: "plain-id"},
+		{ID: "550e8400-e29b-41d4-a716-446655440000"},
+	}
+	for _, want := range cases {
+		data, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary(%+v): %v", want, err)
+		}
+		var got IDRequest
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+		}
+		if got != want {
+			t.Errorf("round trip mismatch: got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestBatchRequestBinaryRoundTrip(t *testing.T) {
+	want := BatchRequest{Requests: []AllocateRequest{{SizeBytes: 1024}, {SizeBytes: 2048}, {SizeBytes: 0}}}
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var got BatchRequest
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+	}
+	if len(got.Requests) != len(want.Requests) {
+		t.Fatalf("got %d requests, want %d", len(got.Requests), len(want.Requests))
+	}
+	for i := range want.Requests {
+		if got.Requests[i] != want.Requests[i] {
+			t.Errorf("request %d: got %+v, want %+v", i, got.Requests[i], want.Requests[i])
+		}
+	}
+}
+
+func TestBatchResponseBinaryRoundTrip(t *testing.T) {
+	want := BatchResponse{Responses: []BatchResponseItem{
+		{AllocateResponse: AllocateResponse{ID: "a1", SizeBytes: 1024, ActualSizeBytes: 1024, LeaseSeconds: 10}},
+		{Error: "backend full"},
+		{AllocateResponse: AllocateResponse{ID: "a2", SizeBytes: 2048, ActualSizeBytes: 2048}},
+	}}
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var got BatchResponse
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+	}
+	if len(got.Responses) != len(want.Responses) {
+		t.Fatalf("got %d responses, want %d", len(got.Responses), len(want.Responses))
+	}
+	for i := range want.Responses {
+		if got.Responses[i] != want.Responses[i] {
+			t.Errorf("response %d: got %+v, want %+v", i, got.Responses[i], want.Responses[i])
+		}
+	}
+}
+
+func TestBatchDeallocateRequestBinaryRoundTrip(t *testing.T) {
+	want := batchDeallocateRequest{IDs: []string{"id-1", "550e8400-e29b-41d4-a716-446655440000", "id-3"}}
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var got batchDeallocateRequest
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+	}
+	if len(got.IDs) != len(want.IDs) {
+		t.Fatalf("got %d ids, want %d", len(got.IDs), len(want.IDs))
+	}
+	for i := range want.IDs {
+		if got.IDs[i] != want.IDs[i] {
+			t.Errorf("id %d: got %q, want %q", i, got.IDs[i], want.IDs[i])
+		}
+	}
+}
+
+func TestBatchDeallocateResponseBinaryRoundTrip(t *testing.T) {
+	want := batchDeallocateResponse{Responses: []batchDeallocateResponseItem{
+		{ID: "id-1"},
+		{Error: "not found"},
+	}}
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var got batchDeallocateResponse
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+	}
+	if len(got.Responses) != len(want.Responses) {
+		t.Fatalf("got %d responses, want %d", len(got.Responses), len(want.Responses))
+	}
+	for i := range want.Responses {
+		if got.Responses[i] != want.Responses[i] {
+			t.Errorf("response %d: got %+v, want %+v", i, got.Responses[i], want.Responses[i])
+		}
+	}
+}
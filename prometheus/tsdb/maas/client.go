@@ -3,31 +3,39 @@
 package maas
 
 import (
-	"bytes"
+	"context"
+	"encoding"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"sync"
 	"time"
 )
 
 // Client manages connections to MaaS backend
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	mu         sync.RWMutex
+	baseURL     string
+	conn        *gridConn
+	mu          sync.RWMutex
 	allocations map[string]*Allocation
-	connected  bool
+	connected   bool
+
+	// RefreshInterval controls both how far ahead of a lease's expiry the
+	// refresh loop renews it and how often the loop wakes when idle.
+	RefreshInterval time.Duration
+
+	leaseMu   sync.Mutex
+	leaseHeap leaseHeap
+	leaseByID map[string]*leaseEntry
 }
 
 // Allocation represents a memory allocation from MaaS
 type Allocation struct {
-	ID               string
-	SizeBytes        int
-	ActualSizeBytes  int
-	Data             []byte
-	AllocatedAt      time.Time
+	ID              string
+	SizeBytes       int
+	ActualSizeBytes int
+	Data            []byte
+	AllocatedAt     time.Time
+	LeaseExpiresAt  time.Time
 }
 
 // AllocateRequest is sent to MaaS to request memory
@@ -35,6 +43,12 @@ type AllocateRequest struct {
 	SizeBytes int `json:"size_bytes"`
 }
 
+// IDRequest is sent to MaaS for ops that only need an allocation ID:
+// deallocate, refresh, and reacquire.
+type IDRequest struct {
+	ID string `json:"id"`
+}
+
 // AllocateResponse is received from MaaS after allocation
 type AllocateResponse struct {
 	ID              string  `json:"id"`
@@ -42,71 +56,145 @@ type AllocateResponse struct {
 	ActualSizeBytes int     `json:"actual_size_bytes"`
 	SizeMB          float64 `json:"size_mb"`
 	AgeSeconds      int64   `json:"age_seconds"`
+	LeaseSeconds    int64   `json:"lease_seconds"`
 }
 
+// defaultRefreshInterval is how far ahead of expiry a lease is renewed,
+// and how often the refresh loop wakes when no lease is outstanding.
+const defaultRefreshInterval = 10 * time.Second
+
+// maxRefreshFailures is how many consecutive refresh failures a lease
+// tolerates before the client stops trying and lets the backend reclaim it.
+const maxRefreshFailures = 3
+
 // NewClient creates a new MaaS client
 func NewClient(baseURL string) *Client {
-	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		allocations: make(map[string]*Allocation),
-		connected:   false,
+	conn, err := newGridConn(baseURL, nil)
+	if err != nil {
+		// baseURL is validated again on Connect(); keep conn nil so
+		// Connect can surface the error instead of panicking here.
+		conn = nil
+	}
+
+	c := &Client{
+		baseURL:         baseURL,
+		conn:            conn,
+		allocations:     make(map[string]*Allocation),
+		connected:       false,
+		RefreshInterval: defaultRefreshInterval,
+		leaseByID:       make(map[string]*leaseEntry),
 	}
+
+	go c.refreshLoop()
+
+	return c
 }
 
-// Connect tests connection to MaaS backend
+// usesBinaryCodec reports whether the negotiated codec on the underlying
+// gridConn is BinaryCodec, as opposed to the JSONCodec default.
+func (c *Client) usesBinaryCodec() bool {
+	return c.conn != nil && c.conn.activeCodec().Name() == (BinaryCodec{}).Name()
+}
+
+// marshalPayload encodes v for the wire: v's MarshalBinary when the
+// negotiated codec is binary and v implements it, JSON otherwise.
+func (c *Client) marshalPayload(v any) ([]byte, error) {
+	if c.usesBinaryCodec() {
+		if bm, ok := v.(encoding.BinaryMarshaler); ok {
+			return bm.MarshalBinary()
+		}
+	}
+	return json.Marshal(v)
+}
+
+// unmarshalPayload decodes data into v: v's UnmarshalBinary when the
+// negotiated codec is binary and v implements it, JSON otherwise.
+func (c *Client) unmarshalPayload(data []byte, v any) error {
+	if c.usesBinaryCodec() {
+		if bu, ok := v.(encoding.BinaryUnmarshaler); ok {
+			return bu.UnmarshalBinary(data)
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Connect establishes the persistent multiplexed WebSocket connection to
+// the MaaS backend and starts the background reconnect loop.
 func (c *Client) Connect() error {
-	resp, err := c.httpClient.Get(c.baseURL + "/health")
-	if err != nil {
-		c.connected = false
-		return fmt.Errorf("failed to connect to MaaS: %w", err)
+	if c.conn == nil {
+		conn, err := newGridConn(c.baseURL, nil)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if err := c.conn.connect(); err != nil {
+		c.mu.Lock()
 		c.connected = false
-		return fmt.Errorf("MaaS health check failed: %d", resp.StatusCode)
+		c.mu.Unlock()
+		return fmt.Errorf("failed to connect to MaaS: %w", err)
 	}
 
+	go c.conn.runReconnectLoop()
+
+	c.mu.Lock()
 	c.connected = true
+	ids := make([]string, 0, len(c.allocations))
+	for id := range c.allocations {
+		ids = append(ids, id)
+	}
+	c.mu.Unlock()
+
+	// Re-announce allocations that survived a disconnect so the backend
+	// doesn't treat them as orphaned and reclaim them underneath us.
+	for _, id := range ids {
+		_ = c.Reacquire(id)
+	}
+
 	return nil
 }
 
 // IsConnected returns true if connected to MaaS backend
 func (c *Client) IsConnected() bool {
+	if c.conn != nil {
+		return c.conn.IsConnected()
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.connected
 }
 
+// Events returns the channel of asynchronous notifications pushed by the
+// backend, such as "allocation evicted" or "backend draining".
+func (c *Client) Events() <-chan Event {
+	return c.conn.Events()
+}
+
 // Allocate requests memory from MaaS backend
 func (c *Client) Allocate(sizeBytes int) (*Allocation, error) {
-	reqBody := AllocateRequest{SizeBytes: sizeBytes}
-	jsonData, err := json.Marshal(reqBody)
+	return c.AllocateContext(context.Background(), sizeBytes)
+}
+
+// AllocateContext requests memory from MaaS backend, canceling the
+// in-flight call if ctx is done before a response arrives.
+func (c *Client) AllocateContext(ctx context.Context, sizeBytes int) (*Allocation, error) {
+	payload, err := c.marshalPayload(AllocateRequest{SizeBytes: sizeBytes})
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	resp, err := c.httpClient.Post(
-		c.baseURL+"/allocate",
-		"application/json",
-		bytes.NewBuffer(jsonData),
-	)
+	resp, err := c.conn.call(ctx, "allocate", payload)
 	if err != nil {
-		c.connected = false
 		return nil, fmt.Errorf("failed to allocate from MaaS: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("allocation failed (%d): %s", resp.StatusCode, string(body))
-	}
 
-	var allocResp AllocateResponse
-	if err := json.NewDecoder(resp.Body).Decode(&allocResp); err != nil {
+	allocResp := allocateResponsePool.Get().(*AllocateResponse)
+	defer func() {
+		*allocResp = AllocateResponse{}
+		allocateResponsePool.Put(allocResp)
+	}()
+	if err := c.unmarshalPayload(resp.Payload, allocResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
@@ -117,6 +205,10 @@ func (c *Client) Allocate(sizeBytes int) (*Allocation, error) {
 		Data:            make([]byte, allocResp.ActualSizeBytes),
 		AllocatedAt:     time.Now(),
 	}
+	if allocResp.LeaseSeconds > 0 {
+		alloc.LeaseExpiresAt = alloc.AllocatedAt.Add(time.Duration(allocResp.LeaseSeconds) * time.Second)
+		c.trackLease(alloc.ID, alloc.LeaseExpiresAt)
+	}
 
 	c.mu.Lock()
 	c.allocations[alloc.ID] = alloc
@@ -125,23 +217,60 @@ func (c *Client) Allocate(sizeBytes int) (*Allocation, error) {
 	return alloc, nil
 }
 
+// Reacquire re-announces a live allocation to the backend, used after a
+// reconnect to avoid the server treating it as orphaned. It renews the
+// lease just like a normal refresh.
+func (c *Client) Reacquire(id string) error {
+	c.mu.RLock()
+	alloc, ok := c.allocations[id]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("maas: unknown allocation %q", id)
+	}
+
+	payload, err := c.marshalPayload(IDRequest{ID: id})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := c.conn.call(context.Background(), "reacquire", payload)
+	if err != nil {
+		return fmt.Errorf("failed to reacquire allocation %s: %w", id, err)
+	}
+
+	var allocResp AllocateResponse
+	if err := c.unmarshalPayload(resp.Payload, &allocResp); err != nil {
+		return fmt.Errorf("failed to decode reacquire response: %w", err)
+	}
+
+	if allocResp.LeaseSeconds > 0 {
+		c.mu.Lock()
+		alloc.LeaseExpiresAt = time.Now().Add(time.Duration(allocResp.LeaseSeconds) * time.Second)
+		c.mu.Unlock()
+		c.trackLease(id, alloc.LeaseExpiresAt)
+	}
+
+	return nil
+}
+
 // Deallocate releases memory back to MaaS
 func (c *Client) Deallocate(id string) error {
-	req, err := http.NewRequest(http.MethodDelete, c.baseURL+"/allocate/"+id, nil)
+	return c.DeallocateContext(context.Background(), id)
+}
+
+// DeallocateContext releases memory back to MaaS, canceling the in-flight
+// call if ctx is done before a response arrives.
+func (c *Client) DeallocateContext(ctx context.Context, id string) error {
+	payload, err := c.marshalPayload(IDRequest{ID: id})
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		c.connected = false
+	if _, err := c.conn.call(ctx, "deallocate", payload); err != nil {
 		return fmt.Errorf("failed to deallocate from MaaS: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
-		return fmt.Errorf("deallocation failed: %d", resp.StatusCode)
-	}
+	c.untrackLease(id)
 
 	c.mu.Lock()
 	delete(c.allocations, id)
@@ -150,11 +279,71 @@ func (c *Client) Deallocate(id string) error {
 	return nil
 }
 
+// refreshLoop periodically renews leases that are close to expiry, using
+// a min-heap so it only ever has to look at the soonest-expiring lease.
+func (c *Client) refreshLoop() {
+	timer := time.NewTimer(c.refreshIntervalOrDefault())
+	defer timer.Stop()
+
+	for range timer.C {
+		timer.Reset(c.refreshDue())
+	}
+}
+
+func (c *Client) refreshIntervalOrDefault() time.Duration {
+	if c.RefreshInterval <= 0 {
+		return defaultRefreshInterval
+	}
+	return c.RefreshInterval
+}
+
+// refreshDue renews any lease within RefreshInterval of expiring and
+// returns how long the loop should sleep before checking again.
+func (c *Client) refreshDue() time.Duration {
+	due, wait := c.popExpiringLeases(c.refreshIntervalOrDefault())
+	for _, entry := range due {
+		c.doRefresh(entry)
+	}
+	return wait
+}
+
+// doRefresh sends a single refresh RPC for entry. On success it requeues
+// the lease with its new expiry; after maxRefreshFailures it gives up and
+// lets the backend reclaim the allocation.
+func (c *Client) doRefresh(entry *leaseEntry) {
+	payload, err := c.marshalPayload(IDRequest{ID: entry.id})
+	if err == nil {
+		var resp frame
+		resp, err = c.conn.call(context.Background(), "refresh", payload)
+		if err == nil {
+			var allocResp AllocateResponse
+			if err = c.unmarshalPayload(resp.Payload, &allocResp); err == nil && allocResp.LeaseSeconds > 0 {
+				newExpiry := time.Now().Add(time.Duration(allocResp.LeaseSeconds) * time.Second)
+				c.mu.Lock()
+				if alloc, ok := c.allocations[entry.id]; ok {
+					alloc.LeaseExpiresAt = newExpiry
+				}
+				c.mu.Unlock()
+				c.trackLease(entry.id, newExpiry)
+				return
+			}
+		}
+	}
+
+	entry.failures++
+	if entry.failures >= maxRefreshFailures {
+		c.untrackLease(entry.id)
+		return
+	}
+
+	c.requeueLease(entry)
+}
+
 // GetStats returns current allocation statistics
 func (c *Client) GetStats() (activeCount int, totalBytes int) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	
+
 	activeCount = len(c.allocations)
 	for _, alloc := range c.allocations {
 		totalBytes += alloc.ActualSizeBytes
@@ -177,5 +366,10 @@ func (c *Client) Cleanup() error {
 			firstErr = err
 		}
 	}
+
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+
 	return firstErr
 }
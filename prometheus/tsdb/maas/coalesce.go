@@ -0,0 +1,159 @@
+package maas
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// batchWindow is how long the coalescing batcher waits for more requests
+// to arrive before issuing an RPC for whatever it has collected.
+const batchWindow = 200 * time.Microsecond
+
+// maxBatchSize caps how many allocations go into a single batched RPC.
+const maxBatchSize = 64
+
+// batchQueueSize bounds how many enqueued-but-not-yet-batched allocation
+// requests ChunkAllocator will buffer before AllocateChunk starts blocking.
+const batchQueueSize = 4096
+
+// allocRequest is one caller's enqueued AllocateChunk call, waiting to be
+// folded into the next outgoing batch.
+type allocRequest struct {
+	size  int
+	key   string
+	reply chan allocResult
+}
+
+type allocResult struct {
+	data []byte
+	err  error
+}
+
+// enqueueAllocation hands size/key to the batcher goroutine and blocks
+// until that request's batch comes back, without itself making a
+// round trip per call.
+func (ca *ChunkAllocator) enqueueAllocation(size int, key string) ([]byte, error) {
+	req := allocRequest{size: size, key: key, reply: make(chan allocResult, 1)}
+	ca.batchCh <- req
+	res := <-req.reply
+	return res.data, res.err
+}
+
+// batcher drains ca.batchCh on a ticker, issuing one batched RPC per
+// backend for everything collected within batchWindow or up to
+// maxBatchSize requests, whichever comes first.
+func (ca *ChunkAllocator) batcher() {
+	ticker := time.NewTicker(batchWindow)
+	defer ticker.Stop()
+
+	var pending []allocRequest
+	for {
+		select {
+		case req := <-ca.batchCh:
+			pending = append(pending, req)
+			if len(pending) >= maxBatchSize {
+				ca.flushBatch(pending)
+				pending = nil
+			}
+		case <-ticker.C:
+			if len(pending) > 0 {
+				ca.flushBatch(pending)
+				pending = nil
+			}
+		}
+	}
+}
+
+// flushBatch groups pending requests by the backend the Router would pick
+// for each, then issues one AllocateBatch RPC per group. Groups go out
+// concurrently: they target different backends, so serializing them would
+// let one slow backend hold up every other group's callers behind the
+// single batcher goroutine.
+func (ca *ChunkAllocator) flushBatch(pending []allocRequest) {
+	groups := make(map[int][]allocRequest)
+	var local []allocRequest
+
+	for _, req := range pending {
+		b, err := ca.poolManager.routeBackend(req.size, req.key)
+		if err != nil {
+			local = append(local, req)
+			continue
+		}
+		groups[b.id] = append(groups[b.id], req)
+	}
+
+	var wg sync.WaitGroup
+	for backendID, group := range groups {
+		wg.Add(1)
+		go func(backendID int, group []allocRequest) {
+			defer wg.Done()
+			ca.flushBackendGroup(backendID, group)
+		}(backendID, group)
+	}
+
+	for _, req := range local {
+		ca.poolManager.recordLocalFallback(req.size)
+		req.reply <- allocResult{data: make([]byte, req.size)}
+	}
+
+	wg.Wait()
+}
+
+// flushBackendGroup issues one AllocateBatch RPC for group and resolves
+// each request's reply channel, falling back to local memory per request
+// when fallback is enabled and the RPC (or an individual item) fails.
+func (ca *ChunkAllocator) flushBackendGroup(backendID int, group []allocRequest) {
+	sizes := make([]int, len(group))
+	for i, req := range group {
+		sizes[i] = req.size
+	}
+
+	allocs, err := ca.poolManager.AllocateBatchOnBackend(backendID, sizes)
+	if err != nil && allocs == nil {
+		for _, req := range group {
+			ca.resolveFailedAllocation(req, err)
+		}
+		return
+	}
+
+	// allocs should mirror group 1:1, but never trust a backend to keep
+	// that promise: a short or long response must not index out of
+	// bounds or leave a caller's reply channel waiting forever.
+	if len(allocs) != len(group) {
+		for _, req := range group {
+			ca.resolveFailedAllocation(req, fmt.Errorf("maas: batch response length %d does not match request length %d for backend %d", len(allocs), len(group), backendID))
+		}
+		return
+	}
+
+	for i, alloc := range allocs {
+		req := group[i]
+		if alloc == nil {
+			ca.resolveFailedAllocation(req, fmt.Errorf("maas: batched allocation failed for backend %d", backendID))
+			continue
+		}
+
+		data := alloc.Data[:req.size]
+		var chunkPtr uintptr
+		if len(data) > 0 {
+			chunkPtr = uintptr(unsafe.Pointer(&data[0]))
+		}
+
+		ca.mu.Lock()
+		ca.chunks[chunkPtr] = trackedChunk{Ref: allocRef{BackendID: backendID, AllocID: alloc.ID, ActualSizeBytes: alloc.ActualSizeBytes}, Data: data}
+		ca.mu.Unlock()
+
+		req.reply <- allocResult{data: data}
+	}
+}
+
+func (ca *ChunkAllocator) resolveFailedAllocation(req allocRequest, err error) {
+	if ca.poolManager.fallbackEnabled {
+		ca.poolManager.recordLocalFallback(req.size)
+		req.reply <- allocResult{data: make([]byte, req.size)}
+		return
+	}
+	req.reply <- allocResult{err: err}
+}
@@ -0,0 +1,129 @@
+package maas
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+)
+
+// CodecAcceptHeader is the value gridConn sends as the WebSocket dial's
+// Accept header to request the compact binary codec; the backend confirms
+// it understood by setting the X-Maas-Codec handshake response header to
+// the binary codec's Name(), and we fall back to JSON if it doesn't.
+const CodecAcceptHeader = "application/x-maas-v1"
+
+// errorOpFlag is OR'd into a binary frame's opcode byte to mark that its
+// payload is an error string rather than a normal response.
+const errorOpFlag byte = 0x80
+
+var binaryOpCodes = map[string]byte{
+	"allocate":         1,
+	"deallocate":       2,
+	"cancel":           3,
+	"event":            4,
+	"refresh":          5,
+	"reacquire":        6,
+	"allocate_batch":   7,
+	"deallocate_batch": 8,
+}
+
+var binaryOpNames = func() map[byte]string {
+	names := make(map[byte]string, len(binaryOpCodes))
+	for name, code := range binaryOpCodes {
+		names[code] = name
+	}
+	return names
+}()
+
+// Codec controls how a gridConn serializes frames on the wire. JSONCodec
+// is the default; BinaryCodec trades readability for a much smaller,
+// allocation-light encoding on the hot allocate/deallocate path.
+type Codec interface {
+	// Name identifies the codec; during Connect() the backend confirms the
+	// binary codec by echoing its Name in the X-Maas-Codec response header.
+	Name() string
+	// EncodeFrame serializes f into a complete wire message.
+	EncodeFrame(f frame) ([]byte, error)
+	// DecodeFrame parses a complete wire message back into a frame.
+	DecodeFrame(raw []byte) (frame, error)
+	// WireMessageType is the gorilla/websocket message type (TextMessage
+	// or BinaryMessage) frames encoded by this codec should be sent as.
+	WireMessageType() int
+}
+
+// JSONCodec is the original, human-readable wire format.
+type JSONCodec struct{}
+
+func (JSONCodec) Name() string { return "json" }
+
+func (JSONCodec) EncodeFrame(f frame) ([]byte, error) {
+	return json.Marshal(f)
+}
+
+func (JSONCodec) DecodeFrame(raw []byte) (frame, error) {
+	var f frame
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return frame{}, err
+	}
+	return f, nil
+}
+
+func (JSONCodec) WireMessageType() int { return websocket.TextMessage }
+
+// BinaryCodec frames every message as
+// [4-byte big-endian length][1-byte op][8-byte muxID][payload], where
+// length covers everything after itself. It never wraps a JSON payload:
+// callers that want the CPU/allocation win are expected to have already
+// encoded payload with the relevant type's MarshalBinary.
+type BinaryCodec struct{}
+
+func (BinaryCodec) Name() string { return "maas-binary-v1" }
+
+func (BinaryCodec) EncodeFrame(f frame) ([]byte, error) {
+	op, ok := binaryOpCodes[f.Op]
+	if !ok {
+		return nil, fmt.Errorf("maas: binary codec has no opcode for %q", f.Op)
+	}
+
+	body := f.Payload
+	if f.Error != "" {
+		op |= errorOpFlag
+		body = []byte(f.Error)
+	}
+
+	buf := make([]byte, 4, 4+1+8+len(body))
+	buf = append(buf, op)
+	buf = binary.BigEndian.AppendUint64(buf, f.MuxID)
+	buf = append(buf, body...)
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(buf)-4))
+
+	return buf, nil
+}
+
+func (BinaryCodec) DecodeFrame(raw []byte) (frame, error) {
+	const headerLen = 4 + 1 + 8
+	if len(raw) < headerLen {
+		return frame{}, fmt.Errorf("maas: binary frame too short (%d bytes)", len(raw))
+	}
+
+	opByte := raw[4]
+	muxID := binary.BigEndian.Uint64(raw[5:13])
+	body := raw[headerLen:]
+
+	name, ok := binaryOpNames[opByte&^errorOpFlag]
+	if !ok {
+		return frame{}, fmt.Errorf("maas: binary frame has unknown opcode %d", opByte&^errorOpFlag)
+	}
+
+	f := frame{MuxID: muxID, Op: name}
+	if opByte&errorOpFlag != 0 {
+		f.Error = string(body)
+	} else {
+		f.Payload = body
+	}
+	return f, nil
+}
+
+func (BinaryCodec) WireMessageType() int { return websocket.BinaryMessage }
@@ -0,0 +1,353 @@
+package maas
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrDisconnected is returned by in-flight calls when the underlying
+// gridConn drops its connection before a response arrives.
+var ErrDisconnected = errors.New("maas: disconnected from backend")
+
+// sendQueueSize bounds the number of outbound frames a gridConn will buffer
+// before a caller sees backpressure.
+const sendQueueSize = 256
+
+// frame is the wire message exchanged over the multiplexed WebSocket
+// connection. Every request/response/cancel/event carries a MuxID so
+// responses can be routed back to the goroutine awaiting them.
+type frame struct {
+	MuxID   uint64          `json:"mux_id"`
+	Op      string          `json:"op"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   string          `json:"error,omitempty"`
+
+	// disconnected marks a frame markDisconnected synthesizes locally to
+	// unblock a pending call; it never goes over the wire, so call() can
+	// trust it to distinguish ErrDisconnected from a real backend error
+	// that happens to carry the same message.
+	disconnected bool
+}
+
+// Event is an asynchronous, server-pushed notification such as
+// "allocation evicted" or "backend draining" that arrives outside the
+// normal request/response flow.
+type Event struct {
+	Type    string
+	Payload json.RawMessage
+}
+
+// gridConn manages a single long-lived, bidirectional WebSocket connection
+// to a MaaS backend, multiplexing many concurrent logical calls over it.
+type gridConn struct {
+	wsURL  string
+	logger *slog.Logger
+
+	connMu sync.Mutex
+	conn   *websocket.Conn
+	// connDone is closed by markDisconnected when conn dies, telling the
+	// read/write pumps started for that connection generation to stop.
+	// Without it, a pump that notices conn==nil would otherwise keep
+	// ranging the shared sendCh/pending maps instead of exiting, and a
+	// second pair of pumps started by the next connect() would race it.
+	connDone chan struct{}
+
+	// preferredCodec is offered during Connect(); codec is what the
+	// backend actually confirmed, falling back to JSONCodec. codec is
+	// replaced on every reconnect while readPump/writePump from the
+	// previous connection may still be winding down, so it's stored in an
+	// atomic.Value rather than read/written directly.
+	preferredCodec Codec
+	codec          atomic.Value // Codec
+
+	connected atomic.Bool
+	closed    atomic.Bool
+
+	nextMuxID atomic.Uint64
+
+	pendingMu sync.Mutex
+	pending   map[uint64]chan frame
+
+	sendCh chan frame
+	events chan Event
+
+	reconnectBackoff time.Duration
+}
+
+const (
+	reconnectBackoffMin = 250 * time.Millisecond
+	reconnectBackoffMax = 30 * time.Second
+)
+
+// newGridConn creates a gridConn for baseURL, translating http(s):// to
+// ws(s):// as needed. It does not dial until connect is called.
+func newGridConn(baseURL string, logger *slog.Logger) (*gridConn, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaaS URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/ws"
+
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &gridConn{
+		wsURL:            u.String(),
+		logger:           logger,
+		preferredCodec:   BinaryCodec{},
+		pending:          make(map[uint64]chan frame),
+		sendCh:           make(chan frame, sendQueueSize),
+		events:           make(chan Event, sendQueueSize),
+		reconnectBackoff: reconnectBackoffMin,
+	}, nil
+}
+
+// connect dials the backend and starts the read/write pumps. It blocks
+// until the initial handshake succeeds or fails. It offers preferredCodec
+// via the Accept header and falls back to JSONCodec unless the backend
+// confirms it understood the offer.
+func (g *gridConn) connect() error {
+	header := http.Header{}
+	header.Set("Accept", CodecAcceptHeader)
+
+	conn, resp, err := websocket.DefaultDialer.Dial(g.wsURL, header)
+	if err != nil {
+		return fmt.Errorf("failed to dial MaaS backend: %w", err)
+	}
+
+	codec := Codec(JSONCodec{})
+	if resp != nil && resp.Header.Get("X-Maas-Codec") == g.preferredCodec.Name() {
+		codec = g.preferredCodec
+	}
+
+	done := make(chan struct{})
+
+	g.connMu.Lock()
+	g.conn = conn
+	g.connDone = done
+	g.connMu.Unlock()
+
+	g.codec.Store(codec)
+	g.connected.Store(true)
+	g.reconnectBackoff = reconnectBackoffMin
+
+	go g.readPump(conn, done)
+	go g.writePump(conn, done)
+
+	return nil
+}
+
+// runReconnectLoop keeps the connection alive in the background, retrying
+// with exponential backoff after an unexpected disconnect.
+func (g *gridConn) runReconnectLoop() {
+	for !g.closed.Load() {
+		if g.connected.Load() {
+			time.Sleep(g.reconnectBackoff)
+			continue
+		}
+
+		if err := g.connect(); err != nil {
+			g.logger.Warn("MaaS reconnect failed, backing off", "error", err, "backoff", g.reconnectBackoff)
+			time.Sleep(g.reconnectBackoff)
+			g.reconnectBackoff *= 2
+			if g.reconnectBackoff > reconnectBackoffMax {
+				g.reconnectBackoff = reconnectBackoffMax
+			}
+			continue
+		}
+
+		g.logger.Info("MaaS connection (re)established")
+	}
+}
+
+// IsConnected reports whether the WebSocket is currently up.
+func (g *gridConn) IsConnected() bool {
+	return g.connected.Load()
+}
+
+// Events returns the channel of asynchronous server-pushed notifications.
+func (g *gridConn) Events() <-chan Event {
+	return g.events
+}
+
+// call sends op/payload as a framed request and waits for the matching
+// response, honoring ctx cancellation by emitting a cancel frame for the
+// in-flight muxID.
+func (g *gridConn) call(ctx context.Context, op string, payload []byte) (frame, error) {
+	muxID := g.nextMuxID.Add(1)
+	replyCh := make(chan frame, 1)
+
+	// Check connected and register into pending under the same lock
+	// markDisconnected drains pending under: otherwise a call could pass
+	// the connected check, then register after markDisconnected's drain
+	// already ran, and never be told about the disconnect until the
+	// next one happens.
+	g.pendingMu.Lock()
+	if !g.connected.Load() {
+		g.pendingMu.Unlock()
+		return frame{}, ErrDisconnected
+	}
+	g.pending[muxID] = replyCh
+	g.pendingMu.Unlock()
+
+	defer func() {
+		g.pendingMu.Lock()
+		delete(g.pending, muxID)
+		g.pendingMu.Unlock()
+	}()
+
+	req := frame{MuxID: muxID, Op: op, Payload: payload}
+	select {
+	case g.sendCh <- req:
+	default:
+		return frame{}, fmt.Errorf("maas: send queue full, backend is not keeping up")
+	}
+
+	select {
+	case resp := <-replyCh:
+		if resp.disconnected {
+			return frame{}, ErrDisconnected
+		}
+		if resp.Error != "" {
+			return frame{}, errors.New(resp.Error)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		select {
+		case g.sendCh <- frame{MuxID: muxID, Op: "cancel"}:
+		default:
+		}
+		return frame{}, ctx.Err()
+	}
+}
+
+// activeCodec returns the codec negotiated by the most recent connect(),
+// defaulting to JSONCodec before the first handshake completes.
+func (g *gridConn) activeCodec() Codec {
+	if c, ok := g.codec.Load().(Codec); ok {
+		return c
+	}
+	return JSONCodec{}
+}
+
+// writePump drains the bounded send queue and writes frames to conn using
+// whichever codec was negotiated in connect(). conn and done are fixed to
+// one connection generation: once done is closed (by markDisconnected, for
+// this conn or any earlier one), the pump exits instead of continuing to
+// drain the shared sendCh, so at most one writePump ever touches conn.
+func (g *gridConn) writePump(conn *websocket.Conn, done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case req := <-g.sendCh:
+			codec := g.activeCodec()
+			data, err := codec.EncodeFrame(req)
+			if len(req.Payload) > 0 {
+				putScratchBuffer(req.Payload)
+			}
+			if err != nil {
+				g.logger.Warn("MaaS frame encode failed, dropping", "op", req.Op, "error", err)
+				continue
+			}
+
+			if err := conn.WriteMessage(codec.WireMessageType(), data); err != nil {
+				g.logger.Warn("MaaS write failed, marking disconnected", "error", err)
+				g.markDisconnected()
+				return
+			}
+		}
+	}
+}
+
+// readPump reads frames off conn and routes them to the waiting caller, or
+// to the events channel for server-pushed notifications. It exits on the
+// first read error, which is always conn's, since conn is fixed for the
+// lifetime of this pump.
+func (g *gridConn) readPump(conn *websocket.Conn, done <-chan struct{}) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			select {
+			case <-done:
+				// Already torn down by writePump or a concurrent
+				// markDisconnected; this is just the socket close.
+			default:
+				g.logger.Warn("MaaS read failed, marking disconnected", "error", err)
+				g.markDisconnected()
+			}
+			return
+		}
+
+		f, err := g.activeCodec().DecodeFrame(data)
+		if err != nil {
+			g.logger.Warn("MaaS frame decode failed, dropping", "error", err)
+			continue
+		}
+
+		if f.Op == "event" {
+			select {
+			case g.events <- Event{Type: f.Error, Payload: f.Payload}:
+			default:
+			}
+			continue
+		}
+
+		g.pendingMu.Lock()
+		ch, ok := g.pending[f.MuxID]
+		g.pendingMu.Unlock()
+		if ok {
+			ch <- f
+		}
+	}
+}
+
+// markDisconnected fails all in-flight calls with ErrDisconnected and
+// flips connected to false so the reconnect loop takes over.
+func (g *gridConn) markDisconnected() {
+	if !g.connected.CompareAndSwap(true, false) {
+		return
+	}
+
+	g.connMu.Lock()
+	if g.conn != nil {
+		g.conn.Close()
+		g.conn = nil
+	}
+	if g.connDone != nil {
+		close(g.connDone)
+		g.connDone = nil
+	}
+	g.connMu.Unlock()
+
+	g.pendingMu.Lock()
+	for muxID, ch := range g.pending {
+		ch <- frame{MuxID: muxID, Error: ErrDisconnected.Error(), disconnected: true}
+	}
+	g.pendingMu.Unlock()
+}
+
+// Close shuts down the connection permanently.
+func (g *gridConn) Close() error {
+	g.closed.Store(true)
+	g.markDisconnected()
+	return nil
+}
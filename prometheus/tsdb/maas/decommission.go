@@ -0,0 +1,236 @@
+package maas
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// migrationRetryBackoff is the delay before retrying a single chunk
+// migration that failed (e.g. because every other backend was briefly
+// unavailable).
+const migrationRetryBackoff = 500 * time.Millisecond
+
+// DecommissionStatus reports the progress of draining a backend.
+type DecommissionStatus struct {
+	BackendID      int
+	Active         bool
+	Total          int
+	Migrated       int
+	RemainingBytes uint64
+	ETASeconds     float64
+}
+
+// decommissionState is the live bookkeeping for one in-progress drain.
+// mu guards every field below it: drain() is the sole writer of the
+// progress fields and the sole reader of cancelled, while
+// CancelDecommission and DecommissionStatus run concurrently from other
+// goroutines.
+type decommissionState struct {
+	backendID int
+	startedAt time.Time
+
+	mu        sync.Mutex
+	cancelled bool
+
+	total          int
+	migrated       int
+	remainingBytes uint64
+	bytesPerSecond float64   // exponential moving average of migration rate
+	lastMigratedAt time.Time // end of the previous successful migration
+}
+
+// isCancelled reports whether the drain has been asked to stop.
+func (st *decommissionState) isCancelled() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.cancelled
+}
+
+// snapshot returns a consistent copy of the progress fields.
+func (st *decommissionState) snapshot() (total, migrated int, remainingBytes uint64, bytesPerSecond float64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.total, st.migrated, st.remainingBytes, st.bytesPerSecond
+}
+
+// Decommission marks backendID as draining and starts migrating its live
+// chunks onto other healthy backends in the background. It may be called
+// again after a prior drain on the same backend was cancelled; a backend
+// whose drain finished stays marked as draining, so calling it again for
+// that backend returns an error.
+func (ca *ChunkAllocator) Decommission(backendID int) error {
+	if err := ca.poolManager.Decommission(backendID); err != nil {
+		return err
+	}
+
+	st := &decommissionState{backendID: backendID, startedAt: time.Now()}
+
+	ca.drainMu.Lock()
+	if ca.drains == nil {
+		ca.drains = make(map[int]*decommissionState)
+	}
+	ca.drains[backendID] = st
+	ca.drainMu.Unlock()
+
+	go ca.drain(st)
+
+	return nil
+}
+
+// CancelDecommission stops an in-progress drain and returns the backend to
+// the active pool; chunks already migrated stay on their new backend.
+func (ca *ChunkAllocator) CancelDecommission(backendID int) error {
+	ca.drainMu.Lock()
+	st, ok := ca.drains[backendID]
+	ca.drainMu.Unlock()
+	if ok {
+		st.mu.Lock()
+		st.cancelled = true
+		st.mu.Unlock()
+	}
+
+	return ca.poolManager.CancelDecommission(backendID)
+}
+
+// DecommissionStatus reports progress for an in-progress or finished drain
+// of backendID.
+func (ca *ChunkAllocator) DecommissionStatus(backendID int) (DecommissionStatus, error) {
+	ca.drainMu.Lock()
+	st, ok := ca.drains[backendID]
+	ca.drainMu.Unlock()
+	if !ok {
+		return DecommissionStatus{}, fmt.Errorf("maas: no decommission in progress for backend %d", backendID)
+	}
+
+	total, migrated, remainingBytes, bytesPerSecond := st.snapshot()
+	status := DecommissionStatus{
+		BackendID:      backendID,
+		Active:         ca.poolManager.IsDraining(backendID),
+		Total:          total,
+		Migrated:       migrated,
+		RemainingBytes: remainingBytes,
+	}
+	if status.Active && bytesPerSecond > 0 {
+		status.ETASeconds = float64(remainingBytes) / bytesPerSecond
+	}
+	return status, nil
+}
+
+// drain iterates every chunk tracked on st.backendID and migrates it to
+// another healthy backend, retrying failed migrations with backoff until
+// the drain is cancelled or nothing is left to move.
+func (ca *ChunkAllocator) drain(st *decommissionState) {
+	for {
+		pending := ca.chunksOnBackend(st.backendID)
+
+		st.mu.Lock()
+		st.total = st.migrated + len(pending)
+		st.remainingBytes = pendingBytes(pending)
+		st.mu.Unlock()
+
+		if len(pending) == 0 {
+			return
+		}
+
+		for chunkPtr := range pending {
+			if st.isCancelled() {
+				return
+			}
+
+			migratedBytes, err := ca.migrateChunk(chunkPtr)
+			if err != nil {
+				ca.logger.Warn("MaaS chunk migration failed, retrying",
+					"backend", st.backendID, "error", err)
+				time.Sleep(migrationRetryBackoff)
+				continue
+			}
+
+			st.mu.Lock()
+			st.migrated++
+			if st.remainingBytes >= uint64(migratedBytes) {
+				st.remainingBytes -= uint64(migratedBytes)
+			}
+			now := time.Now()
+			since := st.lastMigratedAt
+			if since.IsZero() {
+				since = st.startedAt
+			}
+			st.bytesPerSecond = emaRate(st.bytesPerSecond, migratedBytes, now.Sub(since))
+			st.lastMigratedAt = now
+			st.mu.Unlock()
+		}
+	}
+}
+
+// chunksOnBackend snapshots every chunk currently tracked as living on
+// backendID.
+func (ca *ChunkAllocator) chunksOnBackend(backendID int) map[uintptr]trackedChunk {
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+
+	pending := make(map[uintptr]trackedChunk)
+	for chunkPtr, tc := range ca.chunks {
+		if !tc.Ref.isLocal() && tc.Ref.BackendID == backendID {
+			pending[chunkPtr] = tc
+		}
+	}
+	return pending
+}
+
+func pendingBytes(chunks map[uintptr]trackedChunk) uint64 {
+	var total uint64
+	for _, tc := range chunks {
+		total += uint64(len(tc.Data))
+	}
+	return total
+}
+
+// migrateChunk allocates an equal-sized chunk on another healthy backend,
+// copies the bytes across, and atomically rewrites ca.chunks[chunkPtr]
+// to point at the new backend before releasing the old allocation.
+func (ca *ChunkAllocator) migrateChunk(chunkPtr uintptr) (int, error) {
+	ca.mu.RLock()
+	tc, ok := ca.chunks[chunkPtr]
+	ca.mu.RUnlock()
+	if !ok {
+		// Already deallocated or migrated by a concurrent call.
+		return 0, nil
+	}
+
+	newData, newRef, err := ca.poolManager.AllocateBytesWithKey(len(tc.Data), "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate migration target: %w", err)
+	}
+	if newRef.isLocal() {
+		// AllocateBytesWithKey fell back to local memory: no other backend
+		// took the chunk, so leave it on the source and retry later.
+		return 0, fmt.Errorf("no other healthy backend to migrate to")
+	}
+	copy(newData, tc.Data)
+
+	ca.mu.Lock()
+	ca.chunks[chunkPtr] = trackedChunk{Ref: newRef, Data: newData}
+	ca.mu.Unlock()
+
+	if err := ca.poolManager.DeallocateBytes(tc.Data, tc.Ref); err != nil {
+		ca.logger.Warn("Failed to release migrated chunk on source backend",
+			"backend", tc.Ref.BackendID, "id", tc.Ref.AllocID, "error", err)
+	}
+
+	return len(tc.Data), nil
+}
+
+// emaRate folds a new sample into an exponential moving average of bytes
+// migrated per second.
+func emaRate(prev float64, bytesMoved int, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return prev
+	}
+	sample := float64(bytesMoved) / elapsed.Seconds()
+	if prev == 0 {
+		return sample
+	}
+	const alpha = 0.2
+	return alpha*sample + (1-alpha)*prev
+}
@@ -0,0 +1,110 @@
+package maas
+
+import (
+	"container/heap"
+	"time"
+)
+
+// leaseEntry tracks the next refresh deadline for a single live allocation.
+type leaseEntry struct {
+	id        string
+	expiresAt time.Time
+	failures  int
+	index     int // maintained by leaseHeap
+}
+
+// leaseHeap is a min-heap of leaseEntry ordered by expiresAt, so the
+// refresh loop can always find the soonest-expiring lease in O(log n).
+type leaseHeap []*leaseEntry
+
+func (h leaseHeap) Len() int           { return len(h) }
+func (h leaseHeap) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+func (h leaseHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *leaseHeap) Push(x any) {
+	entry := x.(*leaseEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *leaseHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	entry.index = -1
+	*h = old[:n-1]
+	return entry
+}
+
+// trackLease records or refreshes the expiry deadline for id so the
+// refresh loop picks it up.
+func (c *Client) trackLease(id string, expiresAt time.Time) {
+	c.leaseMu.Lock()
+	defer c.leaseMu.Unlock()
+
+	if entry, ok := c.leaseByID[id]; ok {
+		entry.expiresAt = expiresAt
+		entry.failures = 0
+		if entry.index >= 0 {
+			heap.Fix(&c.leaseHeap, entry.index)
+		} else {
+			heap.Push(&c.leaseHeap, entry)
+		}
+		return
+	}
+
+	entry := &leaseEntry{id: id, expiresAt: expiresAt}
+	c.leaseByID[id] = entry
+	heap.Push(&c.leaseHeap, entry)
+}
+
+// popExpiringLeases removes and returns every lease due for refresh within
+// interval, along with how long the refresh loop should sleep before it
+// needs to look again.
+func (c *Client) popExpiringLeases(interval time.Duration) ([]*leaseEntry, time.Duration) {
+	c.leaseMu.Lock()
+	defer c.leaseMu.Unlock()
+
+	now := time.Now()
+	var due []*leaseEntry
+	for c.leaseHeap.Len() > 0 && c.leaseHeap[0].expiresAt.Sub(now) <= interval {
+		due = append(due, heap.Pop(&c.leaseHeap).(*leaseEntry))
+	}
+
+	wait := interval
+	if c.leaseHeap.Len() > 0 {
+		if d := c.leaseHeap[0].expiresAt.Sub(now) - interval; d > 0 && d < wait {
+			wait = d
+		}
+	}
+	return due, wait
+}
+
+// requeueLease pushes entry back onto the heap after a failed refresh
+// attempt, keeping its existing expiry so it is retried promptly.
+func (c *Client) requeueLease(entry *leaseEntry) {
+	c.leaseMu.Lock()
+	defer c.leaseMu.Unlock()
+	heap.Push(&c.leaseHeap, entry)
+}
+
+// untrackLease cancels any pending refresh for id, called when the
+// allocation is deallocated.
+func (c *Client) untrackLease(id string) {
+	c.leaseMu.Lock()
+	defer c.leaseMu.Unlock()
+
+	entry, ok := c.leaseByID[id]
+	if !ok {
+		return
+	}
+	delete(c.leaseByID, id)
+	if entry.index >= 0 {
+		heap.Remove(&c.leaseHeap, entry.index)
+	}
+}
@@ -0,0 +1,79 @@
+package maas
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+)
+
+func TestLeaseHeapOrdering(t *testing.T) {
+	now := time.Now()
+	entries := []*leaseEntry{
+		{id: "c", expiresAt: now.Add(30 * time.Second)},
+		{id: "a", expiresAt: now.Add(10 * time.Second)},
+		{id: "b", expiresAt: now.Add(20 * time.Second)},
+	}
+
+	var h leaseHeap
+	for _, e := range entries {
+		heap.Push(&h, e)
+	}
+
+	var order []string
+	for h.Len() > 0 {
+		order = append(order, heap.Pop(&h).(*leaseEntry).id)
+	}
+
+	want := []string{"a", "b", "c"}
+	if len(order) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(order), len(want))
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Errorf("pop order mismatch: got %v, want %v", order, want)
+			break
+		}
+	}
+}
+
+func TestLeaseHeapFixAfterUpdate(t *testing.T) {
+	now := time.Now()
+	a := &leaseEntry{id: "a", expiresAt: now.Add(10 * time.Second)}
+	b := &leaseEntry{id: "b", expiresAt: now.Add(20 * time.Second)}
+
+	var h leaseHeap
+	heap.Push(&h, a)
+	heap.Push(&h, b)
+
+	// a refreshes and now expires after b; the heap must reorder so b
+	// pops first, not a.
+	a.expiresAt = now.Add(30 * time.Second)
+	heap.Fix(&h, a.index)
+
+	first := heap.Pop(&h).(*leaseEntry)
+	if first.id != "b" {
+		t.Errorf("got %q popped first, want %q after Fix reordered the heap", first.id, "b")
+	}
+}
+
+func TestClientPopExpiringLeases(t *testing.T) {
+	c := &Client{leaseByID: make(map[string]*leaseEntry)}
+
+	now := time.Now()
+	c.trackLease("soon", now.Add(1*time.Second))
+	c.trackLease("later", now.Add(time.Hour))
+
+	due, wait := c.popExpiringLeases(5 * time.Second)
+	if len(due) != 1 || due[0].id != "soon" {
+		t.Fatalf("got due=%v, want only %q due within the interval", due, "soon")
+	}
+	if wait <= 0 {
+		t.Errorf("got non-positive wait %v with a lease still outstanding", wait)
+	}
+
+	c.untrackLease("later")
+	due, _ = c.popExpiringLeases(5 * time.Second)
+	if len(due) != 0 {
+		t.Errorf("got due=%v after untracking the only remaining lease, want none", due)
+	}
+}
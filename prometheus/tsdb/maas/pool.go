@@ -1,6 +1,7 @@
 package maas
 
 import (
+	"fmt"
 	"log/slog"
 	"runtime"
 	"sync"
@@ -8,213 +9,428 @@ import (
 	"time"
 )
 
-// MemoryPoolManager manages allocation strategy between local and MaaS memory
+// BackendConfig describes one MaaS backend in a sharded pool.
+type BackendConfig struct {
+	URL          string
+	CapacityMB   uint64
+	LatencyClass string // e.g. "fast" for a nearby backend, "bulk" for a large remote one
+	NUMANode     int
+	CostWeight   float64
+}
+
+// backend pairs a MaaS client with its configuration and per-backend
+// runtime state.
+type backend struct {
+	id     int
+	cfg    BackendConfig
+	client *Client
+
+	enabled           atomic.Bool
+	healthCheckFailed atomic.Bool
+	draining          atomic.Bool
+
+	localAllocations atomic.Uint64
+	maasAllocations  atomic.Uint64
+	totalAllocated   atomic.Uint64
+	fallbackCount    atomic.Uint64
+}
+
+// localBackendID marks an allocRef as served from local memory rather than
+// a real backend. It must never collide with a real backend index (which
+// are always >= 0), unlike the allocRef{} zero value, which used to be
+// indistinguishable from backend 0.
+const localBackendID = -1
+
+// allocRef identifies which backend an allocation came from, so
+// DeallocateBytes knows where to send the release, and how many bytes it
+// held, so DeallocateBytes can give them back to totalAllocated.
+type allocRef struct {
+	BackendID       int
+	AllocID         string
+	ActualSizeBytes int
+}
+
+// isLocal reports whether the allocation was served from local memory
+// rather than a MaaS backend.
+func (r allocRef) isLocal() bool { return r.BackendID == localBackendID }
+
+// MemoryPoolManager manages allocation strategy between local memory and a
+// set of MaaS backends, routing each allocation via a pluggable Router.
 type MemoryPoolManager struct {
-	maasClient *Client
-	logger     *slog.Logger
-	
+	backends []*backend
+	router   Router
+	logger   *slog.Logger
+
 	// Configuration
-	localMemoryThreshold  uint64 // Bytes - switch to MaaS when local exceeds this
-	maasEnabled          atomic.Bool
+	localMemoryThreshold uint64 // Bytes - switch to MaaS when local exceeds this
 	fallbackEnabled      bool
-	
-	// Statistics
-	localAllocations  atomic.Uint64
-	maasAllocations   atomic.Uint64
-	totalAllocated    atomic.Uint64
-	fallbackCount     atomic.Uint64
-	
+
 	// State
-	mu                sync.RWMutex
-	lastHealthCheck   time.Time
-	healthCheckFailed bool
+	mu              sync.RWMutex
+	lastHealthCheck time.Time
+}
+
+// BackendStats reports per-backend allocation statistics.
+type BackendStats struct {
+	ID             int
+	URL            string
+	LatencyClass   string
+	Healthy        bool
+	Allocations    uint64
+	TotalAllocated uint64
+	FallbackCount  uint64
 }
 
 // PoolStats contains memory pool statistics
 type PoolStats struct {
-	LocalAllocations  uint64
-	MaaSAllocations   uint64
-	TotalAllocated    uint64
-	FallbackCount     uint64
-	MaaSAvailable     bool
-	MemoryStats       runtime.MemStats
+	LocalAllocations uint64
+	MaaSAllocations  uint64
+	TotalAllocated   uint64
+	FallbackCount    uint64
+	MaaSAvailable    bool
+	MemoryStats      runtime.MemStats
+	PerBackend       []BackendStats
 }
 
-// NewMemoryPoolManager creates a new memory pool manager
+// NewMemoryPoolManager creates a memory pool manager backed by a single
+// MaaS endpoint. It is a thin convenience wrapper around
+// NewShardedMemoryPoolManager for the common single-backend case.
 func NewMemoryPoolManager(maasURL string, localThresholdMB uint64, fallbackEnabled bool, logger *slog.Logger) *MemoryPoolManager {
+	var backends []BackendConfig
+	if maasURL != "" {
+		backends = []BackendConfig{{URL: maasURL, LatencyClass: "fast"}}
+	}
+	return NewShardedMemoryPoolManager(backends, nil, localThresholdMB, fallbackEnabled, logger)
+}
+
+// NewShardedMemoryPoolManager creates a memory pool manager that shards
+// allocations across multiple MaaS backends. router selects a backend per
+// allocation; a nil router defaults to SizeBucketRouter.
+func NewShardedMemoryPoolManager(backendCfgs []BackendConfig, router Router, localThresholdMB uint64, fallbackEnabled bool, logger *slog.Logger) *MemoryPoolManager {
 	if logger == nil {
 		logger = slog.Default()
 	}
-	
-	var client *Client
-	if maasURL != "" {
-		client = NewClient(maasURL)
+	if router == nil {
+		router = NewSizeBucketRouter()
 	}
-	
-	mgr := &MemoryPoolManager{
-		maasClient:           client,
+
+	backends := make([]*backend, 0, len(backendCfgs))
+	for i, cfg := range backendCfgs {
+		b := &backend{id: i, cfg: cfg, client: NewClient(cfg.URL)}
+		b.enabled.Store(true)
+		backends = append(backends, b)
+	}
+
+	return &MemoryPoolManager{
+		backends:             backends,
+		router:               router,
 		logger:               logger,
 		localMemoryThreshold: localThresholdMB * 1024 * 1024,
 		fallbackEnabled:      fallbackEnabled,
 	}
-	
-	if client != nil {
-		mgr.maasEnabled.Store(true)
-	}
-	
-	return mgr
 }
 
-// Initialize connects to MaaS and starts monitoring
+// Initialize connects to every backend and starts monitoring
 func (m *MemoryPoolManager) Initialize() error {
-	if m.maasClient == nil {
+	if len(m.backends) == 0 {
 		m.logger.Info("MaaS integration disabled")
 		return nil
 	}
-	
-	if err := m.maasClient.Connect(); err != nil {
-		if m.fallbackEnabled {
-			m.logger.Warn("Failed to connect to MaaS, using local memory only", "error", err)
-			m.maasEnabled.Store(false)
-			return nil
+
+	for _, b := range m.backends {
+		if err := b.client.Connect(); err != nil {
+			if m.fallbackEnabled {
+				m.logger.Warn("Failed to connect to MaaS backend, using local memory only",
+					"backend", b.id, "url", b.cfg.URL, "error", err)
+				b.enabled.Store(false)
+				continue
+			}
+			return err
 		}
-		return err
 	}
-	
+
 	m.logger.Info("MaaS memory pool manager initialized",
+		"backends", len(m.backends),
 		"threshold_mb", m.localMemoryThreshold/1024/1024,
 		"fallback", m.fallbackEnabled)
-	
-	// Start health monitoring
+
 	go m.healthMonitor()
-	
+
+	return nil
+}
+
+// shouldUseMaaS determines if b should receive new allocation traffic.
+func (m *MemoryPoolManager) shouldUseMaaS(b *backend) bool {
+	return b.enabled.Load() && !b.healthCheckFailed.Load() && !b.draining.Load()
+}
+
+// Decommission marks a backend as draining: shouldUseMaaS stops routing
+// new allocations to it, while it otherwise stays up so migration (done
+// by ChunkAllocator.Decommission) can still call Deallocate on it.
+func (m *MemoryPoolManager) Decommission(backendID int) error {
+	b, err := m.backendByID(backendID)
+	if err != nil {
+		return err
+	}
+	if !b.draining.CompareAndSwap(false, true) {
+		return fmt.Errorf("maas: backend %d is already draining", backendID)
+	}
+	m.logger.Info("Decommissioning MaaS backend", "backend", backendID)
 	return nil
 }
 
-// shouldUseMaaS determines if MaaS should be used for allocation
-func (m *MemoryPoolManager) shouldUseMaaS() bool {
-	if !m.maasEnabled.Load() {
+// CancelDecommission puts a draining backend back into the active pool.
+func (m *MemoryPoolManager) CancelDecommission(backendID int) error {
+	b, err := m.backendByID(backendID)
+	if err != nil {
+		return err
+	}
+	b.draining.Store(false)
+	m.logger.Info("Cancelled decommission, backend active again", "backend", backendID)
+	return nil
+}
+
+// IsDraining reports whether backendID is currently being decommissioned.
+func (m *MemoryPoolManager) IsDraining(backendID int) bool {
+	b, err := m.backendByID(backendID)
+	if err != nil {
 		return false
 	}
-	
-	// Check if MaaS is healthy
-	m.mu.RLock()
-	healthyMaaS := !m.healthCheckFailed
-	m.mu.RUnlock()
-	
-	// Use MaaS whenever it's available and healthy to maximize utilization
-	// This allows MaaS to manage its own buffer pool efficiently
-	return healthyMaaS
-}
-
-// AllocateBytes allocates memory, choosing between local and MaaS
-func (m *MemoryPoolManager) AllocateBytes(size int) ([]byte, string, error) {
-	if m.shouldUseMaaS() {
-		// Try MaaS allocation
-		alloc, err := m.maasClient.Allocate(size)
-		if err != nil {
-			m.logger.Warn("MaaS allocation failed, falling back to local", 
-				"size", size, "error", err)
-			m.fallbackCount.Add(1)
-			
-			if m.fallbackEnabled {
-				// Fallback to local
-				m.localAllocations.Add(1)
-				m.totalAllocated.Add(uint64(size))
-				return make([]byte, size), "", nil
+	return b.draining.Load()
+}
+
+// backendByID validates and resolves a backend index.
+func (m *MemoryPoolManager) backendByID(backendID int) (*backend, error) {
+	if backendID < 0 || backendID >= len(m.backends) {
+		return nil, fmt.Errorf("maas: unknown backend %d", backendID)
+	}
+	return m.backends[backendID], nil
+}
+
+// backendInfos builds the Router-facing snapshot of every backend's state.
+func (m *MemoryPoolManager) backendInfos() []BackendInfo {
+	infos := make([]BackendInfo, 0, len(m.backends))
+	for _, b := range m.backends {
+		capacityBytes := b.cfg.CapacityMB * 1024 * 1024
+		allocated := b.totalAllocated.Load()
+		var free uint64
+		if capacityBytes > allocated {
+			free = capacityBytes - allocated
+		}
+		infos = append(infos, BackendInfo{
+			ID:           b.id,
+			CapacityMB:   b.cfg.CapacityMB,
+			LatencyClass: b.cfg.LatencyClass,
+			NUMANode:     b.cfg.NUMANode,
+			CostWeight:   b.cfg.CostWeight,
+			FreeBytes:    free,
+			Healthy:      m.shouldUseMaaS(b),
+		})
+	}
+	return infos
+}
+
+// AllocateBytes allocates memory, routing to a MaaS backend when one is
+// healthy and falling back to local memory otherwise.
+func (m *MemoryPoolManager) AllocateBytes(size int) ([]byte, allocRef, error) {
+	return m.AllocateBytesWithKey(size, "")
+}
+
+// AllocateBytesWithKey is AllocateBytes with a caller-supplied affinity key
+// for routers (such as ConsistentHashRouter) that use it.
+func (m *MemoryPoolManager) AllocateBytesWithKey(size int, key string) ([]byte, allocRef, error) {
+	if len(m.backends) > 0 {
+		id, err := m.router.Route(m.backendInfos(), size, key)
+		if err == nil {
+			b := m.backends[id]
+			alloc, err := b.client.Allocate(size)
+			if err == nil {
+				b.maasAllocations.Add(1)
+				b.totalAllocated.Add(uint64(alloc.ActualSizeBytes))
+				m.logger.Debug("Allocated from MaaS",
+					"backend", b.id, "id", alloc.ID, "requested", size, "actual", alloc.ActualSizeBytes)
+				return alloc.Data[:size], allocRef{BackendID: b.id, AllocID: alloc.ID, ActualSizeBytes: alloc.ActualSizeBytes}, nil
+			}
+
+			m.logger.Warn("MaaS allocation failed, falling back to local",
+				"backend", b.id, "size", size, "error", err)
+			b.fallbackCount.Add(1)
+
+			if !m.fallbackEnabled {
+				return nil, allocRef{}, err
 			}
-			return nil, "", err
 		}
-		
-		m.maasAllocations.Add(1)
-		m.totalAllocated.Add(uint64(alloc.ActualSizeBytes))
-		m.logger.Debug("Allocated from MaaS",
-			"id", alloc.ID,
-			"requested", size,
-			"actual", alloc.ActualSizeBytes)
-		
-		return alloc.Data[:size], alloc.ID, nil
-	}
-	
-	// Use local memory
-	m.localAllocations.Add(1)
-	m.totalAllocated.Add(uint64(size))
-	return make([]byte, size), "", nil
-}
-
-// DeallocateBytes frees memory back to appropriate pool
-func (m *MemoryPoolManager) DeallocateBytes(data []byte, allocID string) error {
-	if allocID == "" {
+	}
+
+	// Local memory, either because no backend is configured/healthy or
+	// because the chosen backend's allocation failed and fallback is on.
+	m.recordLocalFallback(size)
+	return make([]byte, size), allocRef{BackendID: localBackendID}, nil
+}
+
+// recordLocalFallback tracks a local-memory allocation made in place of a
+// MaaS one, whether from AllocateBytes itself or from ChunkAllocator's
+// batcher falling back to local memory for an unrouted or failed request.
+// It's attributed to backend 0 like every other local-fallback stat.
+func (m *MemoryPoolManager) recordLocalFallback(size int) {
+	if len(m.backends) == 0 {
+		return
+	}
+	m.backends[0].localAllocations.Add(1)
+	m.backends[0].totalAllocated.Add(uint64(size))
+}
+
+// routeBackend asks the Router which backend should serve an allocation of
+// size bytes for key, without performing the allocation. Used by the
+// ChunkAllocator's batcher to group coalesced requests per backend.
+func (m *MemoryPoolManager) routeBackend(size int, key string) (*backend, error) {
+	if len(m.backends) == 0 {
+		return nil, ErrNoHealthyBackend
+	}
+	id, err := m.router.Route(m.backendInfos(), size, key)
+	if err != nil {
+		return nil, err
+	}
+	return m.backends[id], nil
+}
+
+// AllocateBatchOnBackend issues one batched Allocate RPC against a specific
+// backend and records the resulting allocations against its stats. The
+// returned slice matches sizes in length and order; an entry is nil if that
+// particular request failed.
+func (m *MemoryPoolManager) AllocateBatchOnBackend(backendID int, sizes []int) ([]*Allocation, error) {
+	b, err := m.backendByID(backendID)
+	if err != nil {
+		return nil, err
+	}
+
+	allocs, err := b.client.AllocateBatch(sizes)
+	for _, alloc := range allocs {
+		if alloc == nil {
+			b.fallbackCount.Add(1)
+			continue
+		}
+		b.maasAllocations.Add(1)
+		b.totalAllocated.Add(uint64(alloc.ActualSizeBytes))
+	}
+
+	return allocs, err
+}
+
+// DeallocateBytes frees memory back to the backend it came from.
+func (m *MemoryPoolManager) DeallocateBytes(data []byte, ref allocRef) error {
+	if ref.isLocal() {
 		// Local allocation, let GC handle it
 		return nil
 	}
-	
-	// MaaS allocation
-	if err := m.maasClient.Deallocate(allocID); err != nil {
-		m.logger.Warn("Failed to deallocate from MaaS", "id", allocID, "error", err)
+
+	if ref.BackendID < 0 || ref.BackendID >= len(m.backends) {
+		return fmt.Errorf("maas: unknown backend %d for allocation %s", ref.BackendID, ref.AllocID)
+	}
+
+	b := m.backends[ref.BackendID]
+	if err := b.client.Deallocate(ref.AllocID); err != nil {
+		m.logger.Warn("Failed to deallocate from MaaS", "backend", b.id, "id", ref.AllocID, "error", err)
 		return err
 	}
-	
-	m.logger.Debug("Deallocated from MaaS", "id", allocID)
+
+	subUint64(&b.totalAllocated, uint64(ref.ActualSizeBytes))
+
+	m.logger.Debug("Deallocated from MaaS", "backend", b.id, "id", ref.AllocID)
 	return nil
 }
 
+// subUint64 atomically subtracts n from u, relying on unsigned wraparound
+// (add the two's-complement of n) since atomic.Uint64 has no Sub.
+func subUint64(u *atomic.Uint64, n uint64) {
+	u.Add(^(n - 1))
+}
+
 // GetStats returns current pool statistics
 func (m *MemoryPoolManager) GetStats() PoolStats {
 	var mem runtime.MemStats
 	runtime.ReadMemStats(&mem)
-	
+
 	stats := PoolStats{
-		LocalAllocations: m.localAllocations.Load(),
-		MaaSAllocations:  m.maasAllocations.Load(),
-		TotalAllocated:   m.totalAllocated.Load(),
-		FallbackCount:    m.fallbackCount.Load(),
-		MaaSAvailable:    m.maasEnabled.Load() && m.maasClient != nil && m.maasClient.IsConnected(),
-		MemoryStats:      mem,
-	}
-	
+		MemoryStats: mem,
+		PerBackend:  make([]BackendStats, 0, len(m.backends)),
+	}
+
+	anyHealthy := false
+	for _, b := range m.backends {
+		healthy := b.enabled.Load() && !b.healthCheckFailed.Load() && b.client.IsConnected()
+		anyHealthy = anyHealthy || healthy
+
+		stats.LocalAllocations += b.localAllocations.Load()
+		stats.MaaSAllocations += b.maasAllocations.Load()
+		stats.TotalAllocated += b.totalAllocated.Load()
+		stats.FallbackCount += b.fallbackCount.Load()
+
+		stats.PerBackend = append(stats.PerBackend, BackendStats{
+			ID:             b.id,
+			URL:            b.cfg.URL,
+			LatencyClass:   b.cfg.LatencyClass,
+			Healthy:        healthy,
+			Allocations:    b.maasAllocations.Load(),
+			TotalAllocated: b.totalAllocated.Load(),
+			FallbackCount:  b.fallbackCount.Load(),
+		})
+	}
+	stats.MaaSAvailable = anyHealthy
+
 	return stats
 }
 
-// healthMonitor periodically checks MaaS health
+// healthMonitor periodically checks every backend's health. Each backend's
+// WebSocket connection reconnects itself in the background, so this just
+// watches connection state instead of polling /health on a timer.
 func (m *MemoryPoolManager) healthMonitor() {
-	if m.maasClient == nil {
+	if len(m.backends) == 0 {
 		return
 	}
-	
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
-	
+
 	for range ticker.C {
-		err := m.maasClient.Connect()
-		
 		m.mu.Lock()
 		m.lastHealthCheck = time.Now()
-		m.healthCheckFailed = err != nil
 		m.mu.Unlock()
-		
-		if err != nil {
-			if m.maasEnabled.Load() {
-				m.logger.Warn("MaaS health check failed, disabling", "error", err)
-				m.maasEnabled.Store(false)
-			}
-		} else {
-			if !m.maasEnabled.Load() {
-				m.logger.Info("MaaS health check succeeded, re-enabling")
-				m.maasEnabled.Store(true)
+
+		for _, b := range m.backends {
+			connected := b.client.IsConnected()
+			b.healthCheckFailed.Store(!connected)
+
+			if !connected {
+				if b.enabled.Load() {
+					m.logger.Warn("MaaS backend connection down, disabling", "backend", b.id)
+					b.enabled.Store(false)
+				}
+			} else {
+				if !b.enabled.Load() {
+					m.logger.Info("MaaS backend connection restored, re-enabling", "backend", b.id)
+					b.enabled.Store(true)
+				}
 			}
 		}
 	}
 }
 
-// Cleanup deallocates all MaaS allocations
+// Cleanup deallocates all MaaS allocations on every backend
 func (m *MemoryPoolManager) Cleanup() error {
-	if m.maasClient == nil {
+	if len(m.backends) == 0 {
 		return nil
 	}
-	
+
 	m.logger.Info("Cleaning up MaaS allocations")
-	return m.maasClient.Cleanup()
+
+	var firstErr error
+	for _, b := range m.backends {
+		if err := b.client.Cleanup(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // SetThreshold updates the local memory threshold (in MB)
@@ -0,0 +1,215 @@
+package maas
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNoHealthyBackend is returned by a Router when no candidate backend is
+// usable for a given allocation.
+var ErrNoHealthyBackend = errors.New("maas: no healthy backend available")
+
+// BackendInfo is the read-only view of a backend's state a Router uses to
+// make a routing decision.
+type BackendInfo struct {
+	ID           int
+	CapacityMB   uint64
+	LatencyClass string
+	NUMANode     int
+	CostWeight   float64
+	FreeBytes    uint64
+	Healthy      bool
+}
+
+// Router picks which backend should serve an allocation of the given size.
+// key is a caller-supplied affinity hint (e.g. a series ID) and is empty
+// when the caller has no preference.
+type Router interface {
+	Route(infos []BackendInfo, size int, key string) (int, error)
+}
+
+func healthyOnly(infos []BackendInfo) []BackendInfo {
+	healthy := make([]BackendInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.Healthy {
+			healthy = append(healthy, info)
+		}
+	}
+	return healthy
+}
+
+// SizeBucketRouter sends small chunks to a fast, usually-local backend and
+// large chunks to a bulk backend, falling back to any healthy backend if
+// no backend is tagged for the chosen bucket.
+type SizeBucketRouter struct {
+	// SmallThresholdBytes is the largest size routed to the "fast" class.
+	SmallThresholdBytes int
+}
+
+// NewSizeBucketRouter creates a SizeBucketRouter using DefaultChunkSize as
+// the small/large cutoff.
+func NewSizeBucketRouter() *SizeBucketRouter {
+	return &SizeBucketRouter{SmallThresholdBytes: DefaultChunkSize}
+}
+
+func (r *SizeBucketRouter) Route(infos []BackendInfo, size int, _ string) (int, error) {
+	healthy := healthyOnly(infos)
+	if len(healthy) == 0 {
+		return 0, ErrNoHealthyBackend
+	}
+
+	wantClass := "bulk"
+	if size <= r.SmallThresholdBytes {
+		wantClass = "fast"
+	}
+
+	for _, info := range healthy {
+		if info.LatencyClass == wantClass {
+			return info.ID, nil
+		}
+	}
+
+	// No backend tagged for this bucket; any healthy backend is better
+	// than failing the allocation outright.
+	return healthy[0].ID, nil
+}
+
+// WeightedRoundRobinRouter routes to the healthy backend with the most
+// free capacity, weighted by each backend's costWeight so that cheaper
+// backends absorb proportionally more traffic.
+type WeightedRoundRobinRouter struct{}
+
+func (r *WeightedRoundRobinRouter) Route(infos []BackendInfo, _ int, _ string) (int, error) {
+	healthy := healthyOnly(infos)
+	if len(healthy) == 0 {
+		return 0, ErrNoHealthyBackend
+	}
+
+	best := healthy[0]
+	bestScore := weightedScore(best)
+	for _, info := range healthy[1:] {
+		if score := weightedScore(info); score > bestScore {
+			best = info
+			bestScore = score
+		}
+	}
+	return best.ID, nil
+}
+
+func weightedScore(info BackendInfo) float64 {
+	weight := info.CostWeight
+	if weight <= 0 {
+		weight = 1
+	}
+	return float64(info.FreeBytes) / weight
+}
+
+// ringVirtualNodes is how many points each backend gets on the hash ring.
+// More points spread a backend's share of the keyspace more evenly; 100 is
+// the usual default for this size of cluster.
+const ringVirtualNodes = 100
+
+// ConsistentHashRouter maps each key to the same backend across calls,
+// so that e.g. all chunks of one series land on the same backend. Unlike
+// key.hash % len(healthy), the ring is built from the full backend set
+// (not just the currently-healthy ones), so a single backend flipping
+// healthy/unhealthy only reshuffles the slice of keyspace it owned —
+// every other key keeps its existing backend.
+//
+// The ring is cached: building ringVirtualNodes points per backend and
+// sorting them is wasted work on every allocation when, in practice, the
+// backend set almost never changes between calls. It's rebuilt only when
+// the set of backend IDs changes.
+type ConsistentHashRouter struct {
+	mu        sync.Mutex
+	ring      []ringPoint
+	ringSetID string
+}
+
+func (r *ConsistentHashRouter) Route(infos []BackendInfo, _ int, key string) (int, error) {
+	healthy := make(map[int]bool, len(infos))
+	for _, info := range infos {
+		if info.Healthy {
+			healthy[info.ID] = true
+		}
+	}
+	if len(healthy) == 0 {
+		return 0, ErrNoHealthyBackend
+	}
+
+	ring := r.ringFor(infos)
+	keyHash := hashKey(key)
+
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= keyHash })
+	for i := 0; i < len(ring); i++ {
+		entry := ring[(start+i)%len(ring)]
+		if healthy[entry.backendID] {
+			return entry.backendID, nil
+		}
+	}
+	return 0, ErrNoHealthyBackend
+}
+
+// ringFor returns the cached ring for the current backend set, rebuilding
+// it only when that set's membership has changed since the last call.
+func (r *ConsistentHashRouter) ringFor(infos []BackendInfo) []ringPoint {
+	setID := backendSetID(infos)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ring == nil || r.ringSetID != setID {
+		r.ring = hashRing(infos)
+		r.ringSetID = setID
+	}
+	return r.ring
+}
+
+// backendSetID returns a string uniquely identifying the set of backend
+// IDs present in infos, independent of order, for cache invalidation.
+func backendSetID(infos []BackendInfo) string {
+	ids := make([]int, len(infos))
+	for i, info := range infos {
+		ids[i] = info.ID
+	}
+	sort.Ints(ids)
+
+	var b strings.Builder
+	for _, id := range ids {
+		fmt.Fprintf(&b, "%d,", id)
+	}
+	return b.String()
+}
+
+// ringPoint is one virtual node on the consistent-hash ring.
+type ringPoint struct {
+	hash      uint32
+	backendID int
+}
+
+// hashRing builds the sorted ring of virtual nodes for the full backend
+// set. It depends only on the set of backend IDs, not on health, so the
+// ring itself is stable across health flaps; Route walks forward from a
+// key's point to find the first currently-healthy owner.
+func hashRing(infos []BackendInfo) []ringPoint {
+	ring := make([]ringPoint, 0, len(infos)*ringVirtualNodes)
+	for _, info := range infos {
+		for v := 0; v < ringVirtualNodes; v++ {
+			ring = append(ring, ringPoint{
+				hash:      hashKey(fmt.Sprintf("%d-%d", info.ID, v)),
+				backendID: info.ID,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	return ring
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,93 @@
+package maas
+
+import "testing"
+
+func allHealthyBackends(n int) []BackendInfo {
+	infos := make([]BackendInfo, n)
+	for i := range infos {
+		infos[i] = BackendInfo{ID: i, Healthy: true}
+	}
+	return infos
+}
+
+// TestConsistentHashRouterStableAcrossHealthFlap verifies that when one
+// backend goes unhealthy, only the keys it owned move to a different
+// backend; every other key keeps the backend it was already assigned.
+func TestConsistentHashRouterStableAcrossHealthFlap(t *testing.T) {
+	r := &ConsistentHashRouter{}
+	infos := allHealthyBackends(5)
+
+	keys := make([]string, 200)
+	before := make([]int, len(keys))
+	for i := range keys {
+		keys[i] = string(rune('a' + i%26))
+		if i >= 26 {
+			keys[i] += string(rune('A' + i/26))
+		}
+		id, err := r.Route(infos, 1024, keys[i])
+		if err != nil {
+			t.Fatalf("Route(%q) with all backends healthy: %v", keys[i], err)
+		}
+		before[i] = id
+	}
+
+	// Flip backend 2 unhealthy, simulating an outage.
+	unhealthy := make([]BackendInfo, len(infos))
+	copy(unhealthy, infos)
+	unhealthy[2].Healthy = false
+
+	var moved, stayed int
+	for i, key := range keys {
+		id, err := r.Route(unhealthy, 1024, key)
+		if err != nil {
+			t.Fatalf("Route(%q) with backend 2 unhealthy: %v", key, err)
+		}
+		if id == 2 {
+			t.Errorf("Route(%q) picked unhealthy backend 2", key)
+		}
+		if before[i] == 2 {
+			moved++
+			continue
+		}
+		if id != before[i] {
+			t.Errorf("key %q moved from backend %d to %d after an unrelated backend's health flipped", key, before[i], id)
+			continue
+		}
+		stayed++
+	}
+
+	if moved == 0 {
+		t.Fatalf("no key was originally routed to backend 2; test setup isn't exercising the failover path")
+	}
+	if stayed == 0 {
+		t.Fatalf("every key moved after a single backend's health flipped; ring is not stable")
+	}
+}
+
+func TestConsistentHashRouterSameKeySameBackend(t *testing.T) {
+	r := &ConsistentHashRouter{}
+	infos := allHealthyBackends(4)
+
+	first, err := r.Route(infos, 1024, "series-42")
+	if err != nil {
+		t.Fatalf("Route: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		id, err := r.Route(infos, 1024, "series-42")
+		if err != nil {
+			t.Fatalf("Route: %v", err)
+		}
+		if id != first {
+			t.Errorf("call %d: got backend %d, want stable %d", i, id, first)
+		}
+	}
+}
+
+func TestConsistentHashRouterNoHealthyBackend(t *testing.T) {
+	r := &ConsistentHashRouter{}
+	infos := []BackendInfo{{ID: 0, Healthy: false}, {ID: 1, Healthy: false}}
+
+	if _, err := r.Route(infos, 1024, "anything"); err != ErrNoHealthyBackend {
+		t.Errorf("got err %v, want ErrNoHealthyBackend", err)
+	}
+}